@@ -2,6 +2,7 @@ package irutil
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -9,7 +10,7 @@ import (
 // DataLayout is a structural representation of the datalayout
 // string from https://llvm.org/docs/LangRef.html#data-layout
 type DataLayout struct {
-	IsBigEndian                bool                                   // default - True
+	IsBigEndian                bool                                   // default - false (little-endian)
 	NaturalStackAlignment      uint64                                 // bits in multiple of 8, default: 0
 	ProgramMemoryAddressSpace  uint64                                 // default - 0
 	GlobalVarAddressSpace      uint64                                 // default - 0
@@ -29,7 +30,7 @@ type DataLayout struct {
 // taken from https://llvm.org/docs/LangRef.html#data-layout
 func NewDataLayout(os string, arch string) *DataLayout {
 	dl := &DataLayout{
-		IsBigEndian:                true,
+		IsBigEndian:                false,
 		NaturalStackAlignment:      0,
 		ProgramMemoryAddressSpace:  0,
 		GlobalVarAddressSpace:      0,
@@ -56,196 +57,212 @@ func NewDataLayout(os string, arch string) *DataLayout {
 // NewDataLayoutFromString parses a datalayout string and constructs a DataLayout object.
 // Default values whereever applicable will be added if options are ommitted.
 //
-// This API expects the string to be valid as per LLVM spec, so there aren't many validations.
+// This API expects the string to be valid as per LLVM spec, so there aren't many validations;
+// unknown specs are ignored and alignments are not validated. Use ParseDataLayout for strict
+// validation.
 func NewDataLayoutFromString(layoutString, os, arch string) (*DataLayout, error) {
 	dl := NewDataLayout(os, arch)
+	if err := dl.parse(layoutString, false); err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// ParseDataLayout strictly parses the given datalayout string as specified by
+// https://llvm.org/docs/LangRef.html#data-layout, using default values for
+// omitted specs. The error names the offending spec and its index if the string
+// contains unknown or malformed specs, alignments which are not a multiple of 8
+// bits or not a power of two bytes, or preferred alignments less than the ABI
+// alignment.
+func ParseDataLayout(layoutString string) (*DataLayout, error) {
+	dl := NewDataLayout("", "")
+	if err := dl.parse(layoutString, true); err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// parse parses the specs of the given datalayout string into dl. If strict is
+// set, unknown specs are rejected and alignments are validated.
+func (dl *DataLayout) parse(layoutString string, strict bool) error {
+	if len(layoutString) == 0 {
+		return nil
+	}
+	for i, spec := range strings.Split(layoutString, "-") {
+		if err := dl.parseSpec(spec, strict); err != nil {
+			return fmt.Errorf("invalid data layout spec %q at index %d: %v", spec, i, err)
+		}
+	}
+	return nil
+}
+
+// parseSpec parses the given datalayout spec into dl. If strict is set, unknown
+// specs are rejected and alignments are validated.
+func (dl *DataLayout) parseSpec(spec string, strict bool) error {
 	var err error
-	specs := strings.Split(layoutString, "-")
-	for _, spec := range specs {
-		if spec == "e" {
-			dl.IsBigEndian = false
-		} else if spec == "E" {
-			dl.IsBigEndian = true
-		} else if strings.HasPrefix(spec, "S") {
-			dl.NaturalStackAlignment, err = strconv.ParseUint(strings.TrimPrefix(spec, "S"), 10, 64)
-			if err != nil {
-				return nil, err
-			}
-		} else if strings.HasPrefix(spec, "P") {
-			dl.ProgramMemoryAddressSpace, err = strconv.ParseUint(strings.TrimPrefix(spec, "P"), 10, 64)
-			if err != nil {
-				return nil, err
-			}
-		} else if strings.HasPrefix(spec, "G") {
-			dl.GlobalVarAddressSpace, err = strconv.ParseUint(strings.TrimPrefix(spec, "G"), 10, 64)
-			if err != nil {
-				return nil, err
-			}
-		} else if strings.HasPrefix(spec, "A") {
-			dl.AllocaAddressSpace, err = strconv.ParseUint(strings.TrimPrefix(spec, "A"), 10, 64)
-			if err != nil {
-				return nil, err
-			}
-		} else if strings.HasPrefix(spec, "p") {
-			addPtrSizeAlignFromString(spec, dl)
-		} else if strings.HasPrefix(spec, "i") {
-			addIntSizeAlignFromString(spec, dl)
-		} else if strings.HasPrefix(spec, "v") {
-			addVectorSizeAlignFromString(spec, dl)
-		} else if strings.HasPrefix(spec, "f") {
-			addFloatSizeAlignFromString(spec, dl)
-		} else if strings.HasPrefix(spec, "a") {
-			addAggAlignFromString(spec, dl)
-		} else if strings.HasPrefix(spec, "F") {
-			addFuncPtrAlignFromString(spec, dl)
-		} else if strings.HasPrefix(spec, "m") {
-			manglingVals := strings.Split(spec, ":")
-			if len(manglingVals) != 2 {
-				return nil, fmt.Errorf(`expecting 1 value separated by ":", but got %q`, spec)
-			}
-			dl.Mangling = ManglingStyle(manglingVals[1])
-		} else if strings.HasPrefix(spec, "n") {
-			addNativeIntBitWidths(spec, dl)
-		} else if strings.HasPrefix(spec, "ni") {
-			niValues := strings.Split(strings.TrimPrefix(spec, "ni"), ":")
-			if len(niValues) == 0 {
-				return nil, fmt.Errorf(`expecting atleast 1 value separated by ":", got %q`, spec)
+	switch {
+	case spec == "e":
+		dl.IsBigEndian = false
+	case spec == "E":
+		dl.IsBigEndian = true
+	case strings.HasPrefix(spec, "S"):
+		dl.NaturalStackAlignment, err = parseAlign(strings.TrimPrefix(spec, "S"), strict, true)
+	case strings.HasPrefix(spec, "P"):
+		dl.ProgramMemoryAddressSpace, err = parseAddrSpace(strings.TrimPrefix(spec, "P"), strict)
+	case strings.HasPrefix(spec, "G"):
+		dl.GlobalVarAddressSpace, err = parseAddrSpace(strings.TrimPrefix(spec, "G"), strict)
+	case strings.HasPrefix(spec, "A"):
+		dl.AllocaAddressSpace, err = parseAddrSpace(strings.TrimPrefix(spec, "A"), strict)
+	case strings.HasPrefix(spec, "p"):
+		err = addPtrSizeAlignFromString(spec, dl, strict)
+	case strings.HasPrefix(spec, "i"):
+		err = addIntSizeAlignFromString(spec, dl, strict)
+	case strings.HasPrefix(spec, "v"):
+		err = addVectorSizeAlignFromString(spec, dl, strict)
+	case strings.HasPrefix(spec, "f"):
+		err = addFloatSizeAlignFromString(spec, dl, strict)
+	case strings.HasPrefix(spec, "a"):
+		err = addAggAlignFromString(spec, dl, strict)
+	case strings.HasPrefix(spec, "F"):
+		err = addFuncPtrAlignFromString(spec, dl, strict)
+	case strings.HasPrefix(spec, "m"):
+		manglingVals := strings.Split(spec, ":")
+		if len(manglingVals) != 2 {
+			return fmt.Errorf(`expecting 1 value separated by ":", but got %q`, spec)
+		}
+		mangling := ManglingStyle(manglingVals[1])
+		if strict {
+			switch mangling {
+			case ELF, Mips, MachO, WinX86COFF, WinCOFF, XCOFF:
+			default:
+				return fmt.Errorf("unknown mangling style %q", mangling)
 			}
-			dl.NonIntegralPointerTypes = niValues
+		}
+		dl.Mangling = mangling
+	case strings.HasPrefix(spec, "ni"):
+		// ni must be matched before n.
+		err = addNonIntegralAddrSpaces(spec, dl, strict)
+	case strings.HasPrefix(spec, "n"):
+		err = addNativeIntBitWidths(spec, dl, strict)
+	default:
+		if strict {
+			return fmt.Errorf("unknown specifier")
 		}
 	}
-	return dl, nil
+	return err
 }
 
-func addPtrSizeAlignFromString(spec string, dl *DataLayout) error {
+func addPtrSizeAlignFromString(spec string, dl *DataLayout, strict bool) error {
 	ptrVals := strings.Split(spec, ":")
 	ptrValsLen := len(ptrVals)
-	if len(ptrVals) < 3 {
-		return fmt.Errorf(`expecting atleast 3 values separated by ":", got %q`, spec)
+	if ptrValsLen < 3 || (strict && ptrValsLen > 5) {
+		return fmt.Errorf(`expecting 3 to 5 values separated by ":", got %q`, spec)
 	}
 	ptrAddSpace := uint64(0)
 	var err error
 	if len(ptrVals[0]) > 1 {
-		ptrAddSpace, err = strconv.ParseUint(strings.TrimPrefix(ptrVals[0], "p"), 10, 64)
+		ptrAddSpace, err = parseAddrSpace(strings.TrimPrefix(ptrVals[0], "p"), strict)
 		if err != nil {
 			return err
 		}
 	}
-	size, err := strconv.ParseUint(ptrVals[1], 10, 64)
+	size, err := parseSize(ptrVals[1], strict)
 	if err != nil {
 		return err
 	}
-	abi, err := strconv.ParseUint(ptrVals[2], 10, 64)
+	abi, err := parseAlign(ptrVals[2], strict, false)
 	if err != nil {
 		return err
 	}
 	pref := abi
 	ind := size
 	if ptrValsLen > 3 {
-		pref, err = strconv.ParseUint(ptrVals[3], 10, 64)
-		if err != nil {
+		if pref, err = parsePrefAlign(ptrVals[3], abi, strict); err != nil {
 			return err
 		}
-		if ptrValsLen == 5 {
-			ind, err = strconv.ParseUint(ptrVals[4], 10, 64)
-			if err != nil {
+		if ptrValsLen > 4 {
+			if ind, err = parseSize(ptrVals[4], strict); err != nil {
 				return err
 			}
+			if strict && ind > size {
+				return fmt.Errorf("index size %d is larger than pointer size %d", ind, size)
+			}
 		}
 	}
 	dl.PointerSizeAlignment[ptrAddSpace] = NewPointerSizeAlignment(ptrAddSpace, size, abi, pref, ind)
 	return nil
 }
 
-func addIntSizeAlignFromString(spec string, dl *DataLayout) error {
-	intVals := strings.Split(spec, ":")
-	intValsLen := len(intVals)
-	if intValsLen < 2 {
-		return fmt.Errorf(`expecting atleast 2 values separated by ":", got %q`, spec)
-	}
-	size, err := strconv.ParseUint(strings.TrimPrefix(intVals[0], "i"), 10, 64)
-	if err != nil {
-		return err
+// parseSizeAlign parses the size, ABI alignment and preferred alignment of the
+// given "<prefix><size>:<abi>[:<pref>]" spec.
+func parseSizeAlign(spec, prefix string, strict bool) (size, abi, pref uint64, err error) {
+	vals := strings.Split(spec, ":")
+	valsLen := len(vals)
+	if valsLen < 2 || (strict && valsLen > 3) {
+		return 0, 0, 0, fmt.Errorf(`expecting 2 or 3 values separated by ":", got %q`, spec)
+	}
+	if size, err = parseSize(strings.TrimPrefix(vals[0], prefix), strict); err != nil {
+		return 0, 0, 0, err
+	}
+	if abi, err = parseAlign(vals[1], strict, false); err != nil {
+		return 0, 0, 0, err
+	}
+	pref = abi
+	if valsLen > 2 {
+		if pref, err = parsePrefAlign(vals[2], abi, strict); err != nil {
+			return 0, 0, 0, err
+		}
 	}
-	abi, err := strconv.ParseUint(intVals[1], 10, 64)
+	return size, abi, pref, nil
+}
+
+func addIntSizeAlignFromString(spec string, dl *DataLayout, strict bool) error {
+	size, abi, pref, err := parseSizeAlign(spec, "i", strict)
 	if err != nil {
 		return err
 	}
-	pref := abi
-	if intValsLen == 3 {
-		pref, err = strconv.ParseUint(intVals[2], 10, 64)
-		if err != nil {
-			return err
-		}
+	if strict && size == 8 && abi != 8 {
+		return fmt.Errorf("i8 must be naturally aligned, got ABI alignment %d", abi)
 	}
 	dl.IntegerSizeAlignment[size] = NewIntegerSizeAlignment(size, abi, pref)
 	return nil
 }
 
-func addVectorSizeAlignFromString(spec string, dl *DataLayout) error {
-	vectorVals := strings.Split(spec, ":")
-	vectorValsLen := len(vectorVals)
-	if vectorValsLen < 2 {
-		return fmt.Errorf(`expecting atleast 2 values separated by ":", got %q`, spec)
-	}
-	size, err := strconv.ParseUint(strings.TrimPrefix(vectorVals[0], "v"), 10, 64)
+func addVectorSizeAlignFromString(spec string, dl *DataLayout, strict bool) error {
+	size, abi, pref, err := parseSizeAlign(spec, "v", strict)
 	if err != nil {
 		return err
 	}
-	abi, err := strconv.ParseUint(vectorVals[1], 10, 64)
-	if err != nil {
-		return err
-	}
-	pref := abi
-	if vectorValsLen == 3 {
-		pref, err = strconv.ParseUint(vectorVals[2], 10, 64)
-		if err != nil {
-			return err
-		}
-	}
 	dl.VectorSizeAlignment[size] = NewVectorSizeAlignment(size, abi, pref)
 	return nil
 }
 
-func addFloatSizeAlignFromString(spec string, dl *DataLayout) error {
-	floatVals := strings.Split(spec, ":")
-	floatValsLen := len(floatVals)
-	if floatValsLen < 2 {
-		return fmt.Errorf(`expecting atleast 2 values separated by ":", got %q`, spec)
-	}
-	size, err := strconv.ParseUint(strings.TrimPrefix(floatVals[0], "f"), 10, 64)
-	if err != nil {
-		return err
-	}
-	abi, err := strconv.ParseUint(floatVals[1], 10, 64)
+func addFloatSizeAlignFromString(spec string, dl *DataLayout, strict bool) error {
+	size, abi, pref, err := parseSizeAlign(spec, "f", strict)
 	if err != nil {
 		return err
 	}
-	pref := abi
-	if floatValsLen == 3 {
-		pref, err = strconv.ParseUint(floatVals[2], 10, 64)
-		if err != nil {
-			return err
-		}
-	}
 	dl.FloatingPointSizeAlignment[size] = NewFloatingPointSizeAlignment(size, abi, pref)
 	return nil
 }
 
-func addAggAlignFromString(spec string, dl *DataLayout) error {
+func addAggAlignFromString(spec string, dl *DataLayout, strict bool) error {
 	aggVals := strings.Split(spec, ":")
 	aggValsLen := len(aggVals)
-	if aggValsLen < 2 {
-		return fmt.Errorf(`expecting atleast 2 values separated by ":", got %q`, spec)
+	if aggValsLen < 2 || (strict && aggValsLen > 3) {
+		return fmt.Errorf(`expecting 2 or 3 values separated by ":", got %q`, spec)
 	}
-	abi, err := strconv.ParseUint(aggVals[1], 10, 64)
+	if strict && aggVals[0] != "a" && aggVals[0] != "a0" {
+		return fmt.Errorf("aggregate alignment must not specify a size, got %q", aggVals[0])
+	}
+	// The ABI alignment of aggregates may be zero.
+	abi, err := parseAlign(aggVals[1], strict, true)
 	if err != nil {
 		return err
 	}
 	pref := abi
-	if aggValsLen == 3 {
-		pref, err = strconv.ParseUint(aggVals[2], 10, 64)
-		if err != nil {
+	if aggValsLen > 2 {
+		if pref, err = parsePrefAlign(aggVals[2], abi, strict); err != nil {
 			return err
 		}
 	}
@@ -253,7 +270,7 @@ func addAggAlignFromString(spec string, dl *DataLayout) error {
 	return nil
 }
 
-func addFuncPtrAlignFromString(spec string, dl *DataLayout) error {
+func addFuncPtrAlignFromString(spec string, dl *DataLayout, strict bool) error {
 	val := strings.TrimPrefix(spec, "F")
 	var typ string
 	if strings.HasPrefix(val, "i") {
@@ -261,9 +278,9 @@ func addFuncPtrAlignFromString(spec string, dl *DataLayout) error {
 	} else if strings.HasPrefix(val, "n") {
 		typ = "n"
 	} else {
-		panic(fmt.Errorf(`invalid function pointer alignment type, expected "i" or "n" prefix, got %q`, spec))
+		return fmt.Errorf(`invalid function pointer alignment type, expected "i" or "n" prefix, got %q`, spec)
 	}
-	abi, err := strconv.ParseUint(strings.TrimPrefix(val, typ), 10, 64)
+	abi, err := parseAlign(strings.TrimPrefix(val, typ), strict, true)
 	if err != nil {
 		return err
 	}
@@ -271,14 +288,14 @@ func addFuncPtrAlignFromString(spec string, dl *DataLayout) error {
 	return nil
 }
 
-func addNativeIntBitWidths(spec string, dl *DataLayout) error {
+func addNativeIntBitWidths(spec string, dl *DataLayout, strict bool) error {
 	// No length validation for widthContents here since "n32"
 	// like values are valid and 32 is validated while parsing.
 	widthContents := strings.Split(strings.TrimPrefix(spec, "n"), ":")
 	widths := make([]uint64, len(widthContents))
 	var err error
 	for i, width := range widthContents {
-		if widths[i], err = strconv.ParseUint(width, 10, 64); err != nil {
+		if widths[i], err = parseSize(width, strict); err != nil {
 			return err
 		}
 	}
@@ -286,110 +303,213 @@ func addNativeIntBitWidths(spec string, dl *DataLayout) error {
 	return nil
 }
 
+func addNonIntegralAddrSpaces(spec string, dl *DataLayout, strict bool) error {
+	niVals := strings.Split(spec, ":")
+	if niVals[0] != "ni" {
+		return fmt.Errorf(`expecting "ni" followed by values separated by ":", got %q`, spec)
+	}
+	niValues := niVals[1:]
+	if strict {
+		for _, v := range niValues {
+			addrSpace, err := parseAddrSpace(v, strict)
+			if err != nil {
+				return err
+			}
+			if addrSpace == 0 {
+				return fmt.Errorf("address space 0 can never be non-integral")
+			}
+		}
+	}
+	if len(niValues) > 0 {
+		dl.NonIntegralPointerTypes = niValues
+	}
+	return nil
+}
+
+// parseSize parses the given size in bits. If strict is set, the size must be
+// non-zero.
+func parseSize(s string, strict bool) (uint64, error) {
+	size, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if strict && size == 0 {
+		return 0, fmt.Errorf("size must be non-zero")
+	}
+	return size, nil
+}
+
+// parseAlign parses the given alignment in bits. If strict is set, the
+// alignment must be a multiple of 8 and a power of two in bytes, or zero if
+// allowZero is set.
+func parseAlign(s string, strict, allowZero bool) (uint64, error) {
+	align, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if !strict || (align == 0 && allowZero) {
+		return align, nil
+	}
+	if align%8 != 0 {
+		return 0, fmt.Errorf("alignment %d is not a multiple of 8 bits", align)
+	}
+	if bytes := align / 8; bytes == 0 || bytes&(bytes-1) != 0 {
+		return 0, fmt.Errorf("alignment %d is not a power of two bytes", align)
+	}
+	return align, nil
+}
+
+// parsePrefAlign parses the given preferred alignment in bits. If strict is
+// set, the preferred alignment must be a valid alignment and at least the given
+// ABI alignment.
+func parsePrefAlign(s string, abi uint64, strict bool) (uint64, error) {
+	pref, err := parseAlign(s, strict, false)
+	if err != nil {
+		return 0, err
+	}
+	if strict && pref < abi {
+		return 0, fmt.Errorf("preferred alignment %d is less than ABI alignment %d", pref, abi)
+	}
+	return pref, nil
+}
+
+// parseAddrSpace parses the given address space. If strict is set, the address
+// space must fit in 24 bits.
+func parseAddrSpace(s string, strict bool) (uint64, error) {
+	addrSpace, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if strict && addrSpace >= 1<<24 {
+		return 0, fmt.Errorf("address space %d out of range", addrSpace)
+	}
+	return addrSpace, nil
+}
+
+// LLString returns the canonical string representation of the data layout, as
+// used in the datalayout string of LLVM IR modules. Specs are written in a
+// deterministic order (e, m, p, F, i, f, v, a, n, S, P, A, G, ni; sized specs
+// sorted by address space or size), and specs equal to the default values of
+// LLVM are omitted, as are optional values equal to their defaults (e.g. the
+// preferred alignment if equal to the ABI alignment).
 func (dl *DataLayout) LLString() string {
-	layout := &strings.Builder{}
+	def := NewDataLayout("", "")
+	var specs []string
 	if dl.IsBigEndian {
-		layout.WriteString("E")
+		specs = append(specs, "E")
 	} else {
-		layout.WriteString("e")
-	}
-	if dl.NaturalStackAlignment != 0 {
-		layout.WriteString("-S")
-		fmt.Fprintf(layout, "%d", dl.NaturalStackAlignment)
-	}
-	if dl.ProgramMemoryAddressSpace != 0 {
-		layout.WriteString("-P")
-		fmt.Fprintf(layout, "%d", dl.ProgramMemoryAddressSpace)
+		specs = append(specs, "e")
 	}
-	if dl.GlobalVarAddressSpace != 0 {
-		layout.WriteString("-G")
-		fmt.Fprintf(layout, "%d", dl.GlobalVarAddressSpace)
+	if len(dl.Mangling) > 0 {
+		specs = append(specs, "m:"+string(dl.Mangling))
 	}
-	if dl.AllocaAddressSpace != 0 {
-		layout.WriteString("-A")
-		fmt.Fprintf(layout, "%d", dl.AllocaAddressSpace)
-	}
-	if len(dl.PointerSizeAlignment) > 0 {
-		for k, v := range dl.PointerSizeAlignment {
-			if k == 0 {
-				layout.WriteString("-p")
-			} else {
-				layout.WriteString("-p")
-				fmt.Fprintf(layout, "%d", k)
+	for _, addrSpace := range sortedKeys(dl.PointerSizeAlignment) {
+		v := dl.PointerSizeAlignment[addrSpace]
+		if d, ok := def.PointerSizeAlignment[addrSpace]; ok && v.Size == d.Size && v.ABIAlignment == d.ABIAlignment && v.PreferredAlignment == d.PreferredAlignment && v.IndexSize() == d.IndexSize() {
+			continue
+		}
+		spec := "p"
+		if addrSpace != 0 {
+			spec += strconv.FormatUint(addrSpace, 10)
+		}
+		spec += ":" + sizeAlignString(v.Size, v.ABIAlignment, v.PreferredAlignment)
+		if idx := v.IndexSize(); idx != v.Size {
+			if v.PreferredAlignment == v.ABIAlignment {
+				// the preferred alignment must precede the index size.
+				spec += fmt.Sprintf(":%d", v.PreferredAlignment)
 			}
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.Size)
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.ABIAlignment)
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.PreferredAlignment)
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.AddressCalculationIndex)
+			spec += fmt.Sprintf(":%d", idx)
 		}
+		specs = append(specs, spec)
 	}
-	if len(dl.IntegerSizeAlignment) > 0 {
-		for k, v := range dl.IntegerSizeAlignment {
-			layout.WriteString("-i")
-			fmt.Fprintf(layout, "%d", k)
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.ABIAlignment)
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.PreferredAlignment)
+	if dl.FunctionPointerAlignment != nil {
+		specs = append(specs, "F"+funcPtrAlignString(dl.FunctionPointerAlignment))
+	}
+	for _, size := range sortedKeys(dl.IntegerSizeAlignment) {
+		v := dl.IntegerSizeAlignment[size]
+		if d, ok := def.IntegerSizeAlignment[size]; !ok || *v != *d {
+			specs = append(specs, "i"+sizeAlignString(size, v.ABIAlignment, v.PreferredAlignment))
 		}
 	}
-	if len(dl.VectorSizeAlignment) > 0 {
-		for k, v := range dl.VectorSizeAlignment {
-			layout.WriteString("-v")
-			fmt.Fprintf(layout, "%d", k)
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.ABIAlignment)
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.PreferredAlignment)
+	for _, size := range sortedKeys(dl.FloatingPointSizeAlignment) {
+		v := dl.FloatingPointSizeAlignment[size]
+		if d, ok := def.FloatingPointSizeAlignment[size]; !ok || *v != *d {
+			specs = append(specs, "f"+sizeAlignString(size, v.ABIAlignment, v.PreferredAlignment))
 		}
 	}
-	if len(dl.FloatingPointSizeAlignment) > 0 {
-		for k, v := range dl.FloatingPointSizeAlignment {
-			layout.WriteString("-f")
-			fmt.Fprintf(layout, "%d", k)
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.ABIAlignment)
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", v.PreferredAlignment)
+	for _, size := range sortedKeys(dl.VectorSizeAlignment) {
+		v := dl.VectorSizeAlignment[size]
+		if d, ok := def.VectorSizeAlignment[size]; !ok || *v != *d {
+			specs = append(specs, "v"+sizeAlignString(size, v.ABIAlignment, v.PreferredAlignment))
 		}
 	}
-	if dl.AggregateAlignment != nil {
-		layout.WriteString("-a:")
-		fmt.Fprintf(layout, "%d", dl.AggregateAlignment.ABIAlignment)
-		layout.WriteString(":")
-		fmt.Fprintf(layout, "%d", dl.AggregateAlignment.PreferredAlignment)
+	if v := dl.AggregateAlignment; v != nil && *v != *def.AggregateAlignment {
+		specs = append(specs, "a"+sizeAlignString(0, v.ABIAlignment, v.PreferredAlignment))
 	}
-	if dl.FunctionPointerAlignment != nil {
-		if dl.FunctionPointerAlignment.IsIndependant {
-			layout.WriteString("-Fi")
-			fmt.Fprintf(layout, "%d", dl.FunctionPointerAlignment.ABIAlignment)
-		} else {
-			layout.WriteString("-Fn")
-			fmt.Fprintf(layout, "%d", dl.FunctionPointerAlignment.ABIAlignment)
-		}
+	if len(dl.NativeIntBitWidths) > 0 {
+		specs = append(specs, "n"+uintsString(dl.NativeIntBitWidths))
 	}
-	layout.WriteString("-m:")
-	layout.WriteString(string(dl.Mangling))
-	if bitWidths := len(dl.NativeIntBitWidths); bitWidths > 0 {
-		layout.WriteString("-n")
-		fmt.Fprintf(layout, "%d", dl.NativeIntBitWidths[0])
-		for i := 1; i < bitWidths; i++ {
-			layout.WriteString(":")
-			fmt.Fprintf(layout, "%d", dl.NativeIntBitWidths[i])
-		}
+	if dl.NaturalStackAlignment != 0 {
+		specs = append(specs, fmt.Sprintf("S%d", dl.NaturalStackAlignment))
+	}
+	if dl.ProgramMemoryAddressSpace != 0 {
+		specs = append(specs, fmt.Sprintf("P%d", dl.ProgramMemoryAddressSpace))
+	}
+	if dl.AllocaAddressSpace != 0 {
+		specs = append(specs, fmt.Sprintf("A%d", dl.AllocaAddressSpace))
+	}
+	if dl.GlobalVarAddressSpace != 0 {
+		specs = append(specs, fmt.Sprintf("G%d", dl.GlobalVarAddressSpace))
 	}
 	if len(dl.NonIntegralPointerTypes) > 0 {
-		layout.WriteString("-ni")
-		for _, v := range dl.NonIntegralPointerTypes {
-			layout.WriteString(":")
-			layout.WriteString(v)
+		specs = append(specs, "ni:"+strings.Join(dl.NonIntegralPointerTypes, ":"))
+	}
+	return strings.Join(specs, "-")
+}
+
+// sizeAlignString returns the "<size>:<abi>[:<pref>]" string representation of
+// the given size and alignments; the size is omitted if zero and the preferred
+// alignment is omitted if equal to the ABI alignment.
+func sizeAlignString(size, abi, pref uint64) string {
+	s := ""
+	if size != 0 {
+		s = strconv.FormatUint(size, 10)
+	}
+	s += fmt.Sprintf(":%d", abi)
+	if pref != abi {
+		s += fmt.Sprintf(":%d", pref)
+	}
+	return s
+}
+
+// sortedKeys returns the keys of the given size and alignment map in increasing
+// order.
+func sortedKeys(m interface{}) []uint64 {
+	var keys []uint64
+	switch m := m.(type) {
+	case map[uint64]*PointerSizeAlignment:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[uint64]*IntegerSizeAlignment:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[uint64]*VectorSizeAlignment:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[uint64]*FloatingPointSizeAlignment:
+		for k := range m {
+			keys = append(keys, k)
 		}
+	default:
+		panic(fmt.Errorf("support for map type %T not yet implemented", m))
 	}
-	return layout.String()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys
 }
 
 type PointerSizeAlignment struct { // All sizes are in bits.
@@ -397,7 +517,16 @@ type PointerSizeAlignment struct { // All sizes are in bits.
 	Size                    uint64
 	ABIAlignment            uint64
 	PreferredAlignment      uint64 // optional and defaults to abi
-	AddressCalculationIndex uint64 // default 0
+	AddressCalculationIndex uint64 // default 0 (same as size)
+}
+
+// IndexSize returns the size in bits of address calculation indices of the
+// pointer; the pointer size if AddressCalculationIndex is 0.
+func (p *PointerSizeAlignment) IndexSize() uint64 {
+	if p.AddressCalculationIndex != 0 {
+		return p.AddressCalculationIndex
+	}
+	return p.Size
 }
 
 func NewPointerSizeAlignment(addSp, size, abiAl, prefAl, addCalInd uint64) *PointerSizeAlignment {
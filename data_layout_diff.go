@@ -0,0 +1,202 @@
+package irutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/ir/types"
+)
+
+// DataLayoutDiff is a component which differs between two data layouts.
+type DataLayoutDiff struct {
+	// Spec of the component, as used in datalayout strings (e.g. "e", "p1" or
+	// "i64").
+	Spec string
+	// Name of the component (e.g. "endianness", "size" or "ABI alignment").
+	Component string
+	// Value of the component in the first and the second data layout. Sizes and
+	// alignments are in bits.
+	X, Y string
+	// Hint reports whether the component is an optimization hint, which does not
+	// affect the memory layout of data, the calling convention or the symbol
+	// names of the target (i.e. preferred alignments, native integer widths and
+	// the natural stack alignment).
+	Hint bool
+}
+
+// String returns the string representation of the data layout difference.
+func (d DataLayoutDiff) String() string {
+	return fmt.Sprintf("%s (%s): %q != %q", d.Component, d.Spec, d.X, d.Y)
+}
+
+// Equal reports whether the data layouts are equivalent; i.e. whether all
+// components are equal, taking default values and the fallback rules of LLVM
+// into account (e.g. pointers of address spaces not specified use the size and
+// alignment of address space 0).
+func (dl *DataLayout) Equal(other *DataLayout) bool {
+	return len(dl.Diff(other)) == 0
+}
+
+// Compatible reports whether data of the data layouts may be shared (e.g. when
+// linking modules of different toolchains); i.e. whether the data layouts only
+// differ in optimization hints, such as preferred alignments.
+func (dl *DataLayout) Compatible(other *DataLayout) bool {
+	for _, d := range dl.Diff(other) {
+		if !d.Hint {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff returns the components which differ between the data layouts, in the
+// canonical order of specs of LLString.
+func (dl *DataLayout) Diff(other *DataLayout) []DataLayoutDiff {
+	var diffs []DataLayoutDiff
+	add := func(spec, component string, x, y interface{}, hint bool) {
+		xs, ys := fmt.Sprint(x), fmt.Sprint(y)
+		if xs != ys {
+			diffs = append(diffs, DataLayoutDiff{Spec: spec, Component: component, X: xs, Y: ys, Hint: hint})
+		}
+	}
+	add("e", "endianness", endianness(dl), endianness(other), false)
+	add("m", "mangling", dl.Mangling, other.Mangling, false)
+	for _, addrSpace := range unionKeys(sortedKeys(dl.PointerSizeAlignment), sortedKeys(other.PointerSizeAlignment)) {
+		x := dl.pointerSizeAlignment(types.AddrSpace(addrSpace))
+		y := other.pointerSizeAlignment(types.AddrSpace(addrSpace))
+		spec := "p"
+		if addrSpace != 0 {
+			spec += strconv.FormatUint(addrSpace, 10)
+		}
+		add(spec, "size", x.Size, y.Size, false)
+		add(spec, "ABI alignment", x.ABIAlignment, y.ABIAlignment, false)
+		add(spec, "preferred alignment", x.PreferredAlignment, y.PreferredAlignment, true)
+		add(spec, "index size", x.IndexSize(), y.IndexSize(), false)
+	}
+	add("F", "function pointer alignment", funcPtrAlignString(dl.FunctionPointerAlignment), funcPtrAlignString(other.FunctionPointerAlignment), false)
+	for _, size := range unionKeys(sortedKeys(dl.IntegerSizeAlignment), sortedKeys(other.IntegerSizeAlignment)) {
+		xabi, xpref := dl.intAlign(size)
+		yabi, ypref := other.intAlign(size)
+		spec := "i" + strconv.FormatUint(size, 10)
+		add(spec, "ABI alignment", xabi, yabi, false)
+		add(spec, "preferred alignment", xpref, ypref, true)
+	}
+	for _, size := range unionKeys(sortedKeys(dl.FloatingPointSizeAlignment), sortedKeys(other.FloatingPointSizeAlignment)) {
+		xabi, xpref := dl.floatAlign(size)
+		yabi, ypref := other.floatAlign(size)
+		spec := "f" + strconv.FormatUint(size, 10)
+		add(spec, "ABI alignment", xabi, yabi, false)
+		add(spec, "preferred alignment", xpref, ypref, true)
+	}
+	for _, size := range unionKeys(sortedKeys(dl.VectorSizeAlignment), sortedKeys(other.VectorSizeAlignment)) {
+		xabi, xpref := dl.vectorAlign(size)
+		yabi, ypref := other.vectorAlign(size)
+		spec := "v" + strconv.FormatUint(size, 10)
+		add(spec, "ABI alignment", xabi, yabi, false)
+		add(spec, "preferred alignment", xpref, ypref, true)
+	}
+	xagg, yagg := aggAlign(dl.AggregateAlignment), aggAlign(other.AggregateAlignment)
+	add("a", "ABI alignment", xagg.ABIAlignment, yagg.ABIAlignment, false)
+	add("a", "preferred alignment", xagg.PreferredAlignment, yagg.PreferredAlignment, true)
+	add("n", "native integer widths", uintsString(dl.NativeIntBitWidths), uintsString(other.NativeIntBitWidths), true)
+	add("S", "natural stack alignment", dl.NaturalStackAlignment, other.NaturalStackAlignment, true)
+	add("P", "program address space", dl.ProgramMemoryAddressSpace, other.ProgramMemoryAddressSpace, false)
+	add("A", "alloca address space", dl.AllocaAddressSpace, other.AllocaAddressSpace, false)
+	add("G", "global variable address space", dl.GlobalVarAddressSpace, other.GlobalVarAddressSpace, false)
+	add("ni", "non-integral address spaces", strings.Join(dl.NonIntegralPointerTypes, ":"), strings.Join(other.NonIntegralPointerTypes, ":"), false)
+	return diffs
+}
+
+// intAlign returns the ABI and preferred alignment in bits of integers of the
+// given size in bits.
+func (dl *DataLayout) intAlign(size uint64) (abi, pref uint64) {
+	if a := dl.intSizeAlignment(size); a != nil {
+		return a.ABIAlignment, a.PreferredAlignment
+	}
+	return naturalAlign(size), naturalAlign(size)
+}
+
+// floatAlign returns the ABI and preferred alignment in bits of floating-point
+// values of the given size in bits.
+func (dl *DataLayout) floatAlign(size uint64) (abi, pref uint64) {
+	if a, ok := dl.FloatingPointSizeAlignment[size]; ok {
+		return a.ABIAlignment, a.PreferredAlignment
+	}
+	return naturalAlign(size), naturalAlign(size)
+}
+
+// vectorAlign returns the ABI and preferred alignment in bits of vectors of the
+// given size in bits.
+func (dl *DataLayout) vectorAlign(size uint64) (abi, pref uint64) {
+	if a, ok := dl.VectorSizeAlignment[size]; ok {
+		return a.ABIAlignment, a.PreferredAlignment
+	}
+	return naturalAlign(size), naturalAlign(size)
+}
+
+// aggAlign returns the given aggregate alignment, or the default aggregate
+// alignment of LLVM if nil.
+func aggAlign(a *AggregateAlignment) *AggregateAlignment {
+	if a == nil {
+		return NewAggregateAlignment(0, 64)
+	}
+	return a
+}
+
+// naturalAlign returns the natural alignment in bits of values of the given
+// size in bits; i.e. the store size rounded up to the nearest power of two
+// bytes.
+func naturalAlign(size uint64) uint64 {
+	align := uint64(1)
+	for align < (size+7)/8 {
+		align <<= 1
+	}
+	return 8 * align
+}
+
+// endianness returns the endianness of the data layout.
+func endianness(dl *DataLayout) string {
+	if dl.IsBigEndian {
+		return "big"
+	}
+	return "little"
+}
+
+// funcPtrAlignString returns the string representation of the given function
+// pointer alignment; or the empty string if nil.
+func funcPtrAlignString(a *FunctionPointerAlignment) string {
+	switch {
+	case a == nil:
+		return ""
+	case a.IsIndependant:
+		return fmt.Sprintf("i%d", a.ABIAlignment)
+	default:
+		return fmt.Sprintf("n%d", a.ABIAlignment)
+	}
+}
+
+// uintsString returns the colon-separated string representation of xs.
+func uintsString(xs []uint64) string {
+	ss := make([]string, len(xs))
+	for i, x := range xs {
+		ss[i] = strconv.FormatUint(x, 10)
+	}
+	return strings.Join(ss, ":")
+}
+
+// unionKeys returns the sorted union of the sorted keys xs and ys.
+func unionKeys(xs, ys []uint64) []uint64 {
+	keys := append(append([]uint64(nil), xs...), ys...)
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	var union []uint64
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			union = append(union, key)
+		}
+	}
+	return union
+}
@@ -0,0 +1,57 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataLayoutDiff(t *testing.T) {
+	parse := func(layout string) *DataLayout {
+		dl, err := ParseDataLayout(layout)
+		require.NoError(t, err)
+		return dl
+	}
+	x86_64 := parse("e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:128-n8:16:32:64-S128")
+	testCases := []struct {
+		name       string
+		x, y       *DataLayout
+		diffs      []DataLayoutDiff
+		compatible bool
+	}{
+		{"Same", x86_64, x86_64, nil, true},
+		{"Defaults", parse("e"), parse("e-p:64:64:64:64-p1:64:64-i64:32:64-i128:32:64-a:0:64"), nil, true},
+		{"Hints", parse("e-i64:64-n32-S64"), parse("e-i64:64:128-n32:64-S128"), []DataLayoutDiff{
+			{Spec: "i64", Component: "preferred alignment", X: "64", Y: "128", Hint: true},
+			{Spec: "n", Component: "native integer widths", X: "32", Y: "32:64", Hint: true},
+			{Spec: "S", Component: "natural stack alignment", X: "64", Y: "128", Hint: true},
+		}, true},
+		{"Endianness", parse("e"), parse("E"), []DataLayoutDiff{
+			{Spec: "e", Component: "endianness", X: "little", Y: "big"},
+		}, false},
+		{"Pointers", parse("e-p1:32:32"), parse("e-p:32:32"), []DataLayoutDiff{
+			{Spec: "p", Component: "size", X: "64", Y: "32"},
+			{Spec: "p", Component: "ABI alignment", X: "64", Y: "32"},
+			{Spec: "p", Component: "preferred alignment", X: "64", Y: "32", Hint: true},
+			{Spec: "p", Component: "index size", X: "64", Y: "32"},
+		}, false},
+		{"Alignments", parse("e-m:e-f80:128-v128:64:128"), parse("e-m:o-f80:32-a:0:32"), []DataLayoutDiff{
+			{Spec: "m", Component: "mangling", X: "e", Y: "o"},
+			{Spec: "f80", Component: "ABI alignment", X: "128", Y: "32"},
+			{Spec: "f80", Component: "preferred alignment", X: "128", Y: "32", Hint: true},
+			{Spec: "v128", Component: "ABI alignment", X: "64", Y: "128"},
+			{Spec: "a", Component: "preferred alignment", X: "64", Y: "32", Hint: true},
+		}, false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.diffs, testCase.x.Diff(testCase.y))
+			assert.Equal(t, len(testCase.diffs) == 0, testCase.x.Equal(testCase.y))
+			assert.Equal(t, testCase.compatible, testCase.x.Compatible(testCase.y))
+			assert.Equal(t, testCase.compatible, testCase.y.Compatible(testCase.x))
+		})
+	}
+	d := DataLayoutDiff{Spec: "f80", Component: "ABI alignment", X: "128", Y: "32"}
+	assert.Equal(t, `ABI alignment (f80): "128" != "32"`, d.String())
+}
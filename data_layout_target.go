@@ -0,0 +1,127 @@
+package irutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dataLayoutPresets maps from normalized target triples (arch-os or
+// arch-os-env) to the default data layout strings emitted by clang 18 for the
+// given target. Targets without an operating system (e.g. WebAssembly) use an
+// empty os component.
+var dataLayoutPresets = map[string]string{
+	// x86-64
+	"x86_64-linux":   "e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32:64-S128",
+	"x86_64-darwin":  "e-m:o-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32:64-S128",
+	"x86_64-windows": "e-m:w-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32:64-S128",
+	"x86_64-freebsd": "e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32:64-S128",
+	// x86
+	"i386-linux":       "e-m:e-p:32:32-p270:32:32-p271:32:32-p272:64:64-i128:128-f64:32:64-f80:32-n8:16:32-S128",
+	"i386-darwin":      "e-m:o-p:32:32-p270:32:32-p271:32:32-p272:64:64-i128:128-f64:32:64-f80:128-n8:16:32-S128",
+	"i386-windows":     "e-m:x-p:32:32-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32-a:0:32-S32",
+	"i386-windows-gnu": "e-m:x-p:32:32-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:32-n8:16:32-a:0:32-S32",
+	"i386-freebsd":     "e-m:e-p:32:32-p270:32:32-p271:32:32-p272:64:64-i128:128-f64:32:64-f80:32-n8:16:32-S128",
+	// AArch64
+	"aarch64-linux":   "e-m:e-i8:8:32-i16:16:32-i64:64-i128:128-n32:64-S128",
+	"aarch64-darwin":  "e-m:o-i64:64-i128:128-n32:64-S128",
+	"aarch64-windows": "e-m:w-p:64:64-i32:32-i64:64-i128:128-n32:64-S128",
+	"aarch64-freebsd": "e-m:e-i8:8:32-i16:16:32-i64:64-i128:128-n32:64-S128",
+	// ARM (AAPCS; APCS on Darwin)
+	"arm-linux":   "e-m:e-p:32:32-Fi8-i64:64-v128:64:128-a:0:32-n32-S64",
+	"arm-darwin":  "e-m:o-p:32:32-Fi8-f64:32:64-v64:32:64-v128:32:128-a:0:32-n32-S32",
+	"arm-windows": "e-m:w-p:32:32-Fi8-i64:64-v128:64:128-a:0:32-n32-S64",
+	"arm-freebsd": "e-m:e-p:32:32-Fi8-i64:64-v128:64:128-a:0:32-n32-S64",
+	// RISC-V
+	"riscv32-linux":   "e-m:e-p:32:32-i64:64-n32-S128",
+	"riscv32-freebsd": "e-m:e-p:32:32-i64:64-n32-S128",
+	"riscv64-linux":   "e-m:e-p:64:64-i64:64-i128:128-n64-S128",
+	"riscv64-freebsd": "e-m:e-p:64:64-i64:64-i128:128-n64-S128",
+	// MIPS (O32, big-endian)
+	"mips-linux":   "E-m:m-p:32:32-i8:8:32-i16:16:32-i64:64-n32-S64",
+	"mips-freebsd": "E-m:m-p:32:32-i8:8:32-i16:16:32-i64:64-n32-S64",
+	// PowerPC64 (little-endian)
+	"ppc64le-linux":   "e-m:e-Fn32-i64:64-n32:64-S128-v256:256:256-v512:512:512",
+	"ppc64le-freebsd": "e-m:e-Fn32-i64:64-n32:64-S128-v256:256:256-v512:512:512",
+	// WebAssembly
+	"wasm32-": "e-m:e-p:32:32-p10:8:8-p20:8:8-i64:64-n32:64-S128-ni:1:10:20",
+	"wasm64-": "e-m:e-p:64:64-p10:8:8-p20:8:8-i64:64-n32:64-S128-ni:1:10:20",
+}
+
+// NewDataLayoutForTriple returns the default data layout of the given LLVM
+// target triple (e.g. "x86_64-unknown-linux-gnu" or "arm64-apple-macosx11.0.0"),
+// as specified by clang. Architecture and operating system aliases are
+// normalized (e.g. "amd64" and "x86_64", "i686" and "i386", "macosx" and
+// "darwin"). An error is returned if the target is not supported.
+func NewDataLayoutForTriple(triple string) (*DataLayout, error) {
+	arch, os, env := normalizeTriple(triple)
+	layout, ok := dataLayoutPresets[arch+"-"+os+"-"+env]
+	if !ok {
+		layout, ok = dataLayoutPresets[arch+"-"+os]
+	}
+	if !ok {
+		return nil, fmt.Errorf("support for data layout of target triple %q not yet implemented", triple)
+	}
+	return ParseDataLayout(layout)
+}
+
+// normalizeTriple returns the normalized architecture, operating system and
+// environment of the given LLVM target triple. Operating systems without data
+// layout presets (e.g. "unknown", "wasi" or "none") are normalized to the empty
+// string.
+func normalizeTriple(triple string) (arch, os, env string) {
+	parts := strings.Split(triple, "-")
+	arch = normalizeArch(parts[0])
+	// The vendor component is optional in triples such as "x86_64-linux-gnu".
+	rest := parts[1:]
+	if len(rest) > 0 && normalizeOS(rest[0]) == "" {
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		os = normalizeOS(rest[0])
+		if rest[0] == "mingw32" {
+			env = "gnu"
+		}
+	}
+	if len(rest) > 1 {
+		env = rest[1]
+	}
+	return arch, os, env
+}
+
+// normalizeArch returns the normalized architecture name of the given
+// architecture component of an LLVM target triple.
+func normalizeArch(arch string) string {
+	switch {
+	case arch == "amd64" || arch == "x86_64":
+		return "x86_64"
+	case arch == "x86" || len(arch) == 4 && arch[0] == 'i' && strings.HasSuffix(arch, "86"):
+		// i386, i486, i586, i686
+		return "i386"
+	case arch == "arm64" || arch == "aarch64":
+		return "aarch64"
+	case strings.HasPrefix(arch, "armv"), strings.HasPrefix(arch, "thumbv"), arch == "arm", arch == "thumb":
+		return "arm"
+	case arch == "powerpc64le":
+		return "ppc64le"
+	default:
+		return arch
+	}
+}
+
+// normalizeOS returns the normalized operating system name of the given
+// operating system component of an LLVM target triple, or the empty string if
+// not recognized.
+func normalizeOS(os string) string {
+	switch {
+	case strings.HasPrefix(os, "linux"):
+		return "linux"
+	case strings.HasPrefix(os, "darwin"), strings.HasPrefix(os, "macos"), strings.HasPrefix(os, "ios"):
+		return "darwin"
+	case strings.HasPrefix(os, "windows"), strings.HasPrefix(os, "win32"), os == "mingw32":
+		return "windows"
+	case strings.HasPrefix(os, "freebsd"):
+		return "freebsd"
+	default:
+		return ""
+	}
+}
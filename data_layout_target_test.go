@@ -0,0 +1,134 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDataLayoutForTriple(t *testing.T) {
+	testCases := []struct {
+		triple    string
+		bigEndian bool
+		ptrSize   uint64
+		mangling  ManglingStyle
+	}{
+		{"x86_64-unknown-linux-gnu", false, 64, ELF},
+		{"x86_64-apple-macosx10.15.0", false, 64, MachO},
+		{"x86_64-pc-windows-msvc", false, 64, WinCOFF},
+		{"amd64-unknown-freebsd13.0", false, 64, ELF},
+		{"x86_64-linux-gnu", false, 64, ELF},
+		{"i686-pc-linux-gnu", false, 32, ELF},
+		{"i686-pc-windows-msvc", false, 32, WinX86COFF},
+		{"i686-w64-mingw32", false, 32, WinX86COFF},
+		{"arm64-apple-macosx11.0.0", false, 64, MachO},
+		{"aarch64-unknown-linux-gnu", false, 64, ELF},
+		{"aarch64-pc-windows-msvc", false, 64, WinCOFF},
+		{"armv7-unknown-linux-gnueabihf", false, 32, ELF},
+		{"thumbv7-pc-windows-msvc", false, 32, WinCOFF},
+		{"riscv32-unknown-linux-gnu", false, 32, ELF},
+		{"riscv64-unknown-freebsd", false, 64, ELF},
+		{"mips-unknown-linux-gnu", true, 32, Mips},
+		{"powerpc64le-unknown-linux-gnu", false, 64, ELF},
+		{"wasm32-unknown-unknown", false, 32, ELF},
+		{"wasm64-unknown-emscripten", false, 64, ELF},
+		{"wasm32-wasi", false, 32, ELF},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.triple, func(t *testing.T) {
+			dl, err := NewDataLayoutForTriple(testCase.triple)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.bigEndian, dl.IsBigEndian)
+			assert.Equal(t, testCase.ptrSize, dl.pointerSizeAlignment(0).Size)
+			assert.Equal(t, testCase.mangling, dl.Mangling)
+		})
+	}
+	// x86_fp80 layout differs between i386 Linux and Windows (MSVC).
+	fp80 := func(triple string) uint64 {
+		dl, err := NewDataLayoutForTriple(triple)
+		require.NoError(t, err)
+		return dl.FloatingPointSizeAlignment[80].ABIAlignment
+	}
+	assert.Equal(t, uint64(32), fp80("i386-unknown-linux-gnu"))
+	assert.Equal(t, uint64(128), fp80("i386-pc-windows-msvc"))
+	assert.Equal(t, uint64(32), fp80("i386-pc-windows-gnu"))
+	// i128 is 16-byte aligned on x86 since clang 18.
+	x86, err := NewDataLayoutForTriple("x86_64-unknown-linux-gnu")
+	require.NoError(t, err)
+	align, err := x86.ABIAlignment(types.I128)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(16), align)
+	// WebAssembly externref and funcref address spaces are non-integral.
+	wasm, err := NewDataLayoutForTriple("wasm32-unknown-unknown")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "10", "20"}, wasm.NonIntegralPointerTypes)
+	assert.Equal(t, uint64(8), wasm.pointerSizeAlignment(10).Size)
+	for _, triple := range []string{"", "sparc-unknown-linux-gnu", "x86_64-unknown-unknown"} {
+		_, err := NewDataLayoutForTriple(triple)
+		assert.Error(t, err, "triple %q", triple)
+	}
+}
+
+func TestDataLayoutPresets(t *testing.T) {
+	for key, layout := range dataLayoutPresets {
+		_, err := ParseDataLayout(layout)
+		assert.NoError(t, err, "preset %q", key)
+	}
+}
+
+func TestNewDataLayoutLittleEndian(t *testing.T) {
+	assert.False(t, NewDataLayout("", "").IsBigEndian)
+}
+
+func TestDataLayoutPresetsClang(t *testing.T) {
+	// Data layout strings emitted by clang 18 for the given target triples.
+	testCases := []struct {
+		triple string
+		layout string
+	}{
+		{"x86_64-unknown-linux-gnu", "e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32:64-S128"},
+		{"x86_64-apple-macosx10.15.0", "e-m:o-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32:64-S128"},
+		{"x86_64-pc-windows-msvc", "e-m:w-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32:64-S128"},
+		{"x86_64-unknown-freebsd", "e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32:64-S128"},
+		{"i686-pc-linux-gnu", "e-m:e-p:32:32-p270:32:32-p271:32:32-p272:64:64-i128:128-f64:32:64-f80:32-n8:16:32-S128"},
+		{"i686-apple-macosx10.15.0", "e-m:o-p:32:32-p270:32:32-p271:32:32-p272:64:64-i128:128-f64:32:64-f80:128-n8:16:32-S128"},
+		{"i686-pc-windows-msvc", "e-m:x-p:32:32-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32-a:0:32-S32"},
+		{"i686-w64-windows-gnu", "e-m:x-p:32:32-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:32-n8:16:32-a:0:32-S32"},
+		{"i686-unknown-freebsd", "e-m:e-p:32:32-p270:32:32-p271:32:32-p272:64:64-i128:128-f64:32:64-f80:32-n8:16:32-S128"},
+		{"aarch64-unknown-linux-gnu", "e-m:e-i8:8:32-i16:16:32-i64:64-i128:128-n32:64-S128"},
+		{"arm64-apple-macosx11.0.0", "e-m:o-i64:64-i128:128-n32:64-S128"},
+		{"aarch64-pc-windows-msvc", "e-m:w-p:64:64-i32:32-i64:64-i128:128-n32:64-S128"},
+		{"aarch64-unknown-freebsd", "e-m:e-i8:8:32-i16:16:32-i64:64-i128:128-n32:64-S128"},
+		{"armv7-unknown-linux-gnueabihf", "e-m:e-p:32:32-Fi8-i64:64-v128:64:128-a:0:32-n32-S64"},
+		{"armv7-apple-darwin", "e-m:o-p:32:32-Fi8-f64:32:64-v64:32:64-v128:32:128-a:0:32-n32-S32"},
+		{"thumbv7-pc-windows-msvc", "e-m:w-p:32:32-Fi8-i64:64-v128:64:128-a:0:32-n32-S64"},
+		{"armv7-unknown-freebsd", "e-m:e-p:32:32-Fi8-i64:64-v128:64:128-a:0:32-n32-S64"},
+		{"riscv32-unknown-linux-gnu", "e-m:e-p:32:32-i64:64-n32-S128"},
+		{"riscv32-unknown-freebsd", "e-m:e-p:32:32-i64:64-n32-S128"},
+		{"riscv64-unknown-linux-gnu", "e-m:e-p:64:64-i64:64-i128:128-n64-S128"},
+		{"riscv64-unknown-freebsd", "e-m:e-p:64:64-i64:64-i128:128-n64-S128"},
+		{"mips-unknown-linux-gnu", "E-m:m-p:32:32-i8:8:32-i16:16:32-i64:64-n32-S64"},
+		{"mips-unknown-freebsd", "E-m:m-p:32:32-i8:8:32-i16:16:32-i64:64-n32-S64"},
+		{"powerpc64le-unknown-linux-gnu", "e-m:e-Fn32-i64:64-n32:64-S128-v256:256:256-v512:512:512"},
+		{"powerpc64le-unknown-freebsd", "e-m:e-Fn32-i64:64-n32:64-S128-v256:256:256-v512:512:512"},
+		{"wasm32-unknown-unknown", "e-m:e-p:32:32-p10:8:8-p20:8:8-i64:64-n32:64-S128-ni:1:10:20"},
+		{"wasm64-unknown-unknown", "e-m:e-p:64:64-p10:8:8-p20:8:8-i64:64-n32:64-S128-ni:1:10:20"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.triple, func(t *testing.T) {
+			arch, os, env := normalizeTriple(testCase.triple)
+			layout, ok := dataLayoutPresets[arch+"-"+os+"-"+env]
+			if !ok {
+				layout = dataLayoutPresets[arch+"-"+os]
+			}
+			assert.Equal(t, testCase.layout, layout)
+			dl, err := NewDataLayoutForTriple(testCase.triple)
+			require.NoError(t, err)
+			want, err := ParseDataLayout(testCase.layout)
+			require.NoError(t, err)
+			assert.Empty(t, dl.Diff(want))
+		})
+	}
+}
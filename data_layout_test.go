@@ -8,6 +8,8 @@ import (
 	"testing"
 
 	"github.com/llir/llvm/asm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDataLayoutString(t *testing.T) {
@@ -45,3 +47,102 @@ func TestDataLayoutString(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDataLayout(t *testing.T) {
+	dl, err := ParseDataLayout("E-m:e-p:32:32:64-p1:64:64:64:32-i64:64-f80:128-Fn8-ni:1:2-n8:16:32-S128-A5-a:0:32")
+	require.NoError(t, err)
+	assert.True(t, dl.IsBigEndian)
+	assert.Equal(t, ELF, dl.Mangling)
+	assert.Equal(t, NewPointerSizeAlignment(0, 32, 32, 64, 32), dl.PointerSizeAlignment[0])
+	assert.Equal(t, NewPointerSizeAlignment(1, 64, 64, 64, 32), dl.PointerSizeAlignment[1])
+	assert.Equal(t, NewIntegerSizeAlignment(64, 64, 64), dl.IntegerSizeAlignment[64])
+	assert.Equal(t, NewFloatingPointSizeAlignment(80, 128, 128), dl.FloatingPointSizeAlignment[80])
+	assert.Equal(t, NewFunctionPointerAlignment(false, 8), dl.FunctionPointerAlignment)
+	assert.Equal(t, []string{"1", "2"}, dl.NonIntegralPointerTypes)
+	assert.Equal(t, []uint64{8, 16, 32}, dl.NativeIntBitWidths)
+	assert.Equal(t, uint64(128), dl.NaturalStackAlignment)
+	assert.Equal(t, uint64(5), dl.AllocaAddressSpace)
+	assert.Equal(t, NewAggregateAlignment(0, 32), dl.AggregateAlignment)
+
+	testCases := []struct {
+		name   string
+		layout string
+		err    string
+	}{
+		{"UnknownSpec", "e-x", `spec "x" at index 1: unknown specifier`},
+		{"EmptySpec", "e--S128", `spec "" at index 1: unknown specifier`},
+		{"AlignNotMultipleOf8", "e-i64:60", `spec "i64:60" at index 1: alignment 60 is not a multiple of 8 bits`},
+		{"AlignNotPowerOfTwo", "e-f80:96", `spec "f80:96" at index 1: alignment 96 is not a power of two bytes`},
+		{"PrefLessThanABI", "e-p:64:64:32", `spec "p:64:64:32" at index 1: preferred alignment 32 is less than ABI alignment 64`},
+		{"IndexLargerThanPointer", "p:32:32:32:64", `spec "p:32:32:32:64" at index 0: index size 64 is larger than pointer size 32`},
+		{"PointerTooManyValues", "p:64:64:64:64:64", `at index 0: expecting 3 to 5 values`},
+		{"ZeroSize", "e-i0:8", `spec "i0:8" at index 1: size must be non-zero`},
+		{"I8NotNaturallyAligned", "i8:16", `i8 must be naturally aligned`},
+		{"MissingAlign", "e-v128", `spec "v128" at index 1: expecting 2 or 3 values`},
+		{"SizedAggregate", "a64:64", `aggregate alignment must not specify a size`},
+		{"FuncPtrType", "Fx8", `invalid function pointer alignment type`},
+		{"Mangling", "e-m:z", `spec "m:z" at index 1: unknown mangling style "z"`},
+		{"NonIntegralZero", "e-ni:0", `address space 0 can never be non-integral`},
+		{"NonIntegralSyntax", "e-ni1", `expecting "ni"`},
+		{"AddrSpaceRange", "A16777216", `address space 16777216 out of range`},
+		{"Number", "S1x", `spec "S1x" at index 0: strconv.ParseUint`},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := ParseDataLayout(testCase.layout)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), testCase.err)
+		})
+	}
+}
+
+func TestNewDataLayoutFromStringErrors(t *testing.T) {
+	// Unknown specs and invalid alignments are accepted.
+	dl, err := NewDataLayoutFromString("e-x-i64:60-ni:1", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(60), dl.IntegerSizeAlignment[64].ABIAlignment)
+	assert.Equal(t, []string{"1"}, dl.NonIntegralPointerTypes)
+	// Malformed specs are rejected.
+	for _, layout := range []string{"e-p:x:64", "e-i64", "Fx8"} {
+		_, err := NewDataLayoutFromString(layout, "", "")
+		assert.Error(t, err, "layout %q", layout)
+	}
+}
+
+func TestDataLayoutLLString(t *testing.T) {
+	for key, layout := range dataLayoutPresets {
+		dl, err := ParseDataLayout(layout)
+		require.NoError(t, err)
+		s := dl.LLString()
+		// The canonical string is equivalent to the preset, and a fixed point.
+		dl2, err := ParseDataLayout(s)
+		require.NoError(t, err)
+		assert.True(t, dl.Equal(dl2), "preset %q", key)
+		assert.Equal(t, dl, dl2, "preset %q", key)
+		assert.Equal(t, s, dl2.LLString(), "preset %q", key)
+	}
+	testCases := []struct {
+		layout   string
+		expected string
+	}{
+		{"", "e"},
+		{"E", "E"},
+		{"p:64:64:64-i64:32:64-f32:32-a:0:64-v128:128", "e"},
+		{"S128-n32:64-i64:64-e-m:o", "e-m:o-i64:64-n32:64-S128"},
+		{"e-m:o-i64:64-n32:64-S128", "e-m:o-i64:64-n32:64-S128"},
+		{"p1:32:32-p:32:32:32:16-i128:128-i8:8:32", "e-p:32:32:32:16-p1:32:32-i8:8:32-i128:128"},
+		{"G1-A5-P2-ni:7:8-Fn16", "e-Fn16-P2-A5-G1-ni:7:8"},
+		{"e-m:e-Fn32-i64:64-n32:64-S128-v256:256:256-v512:512:512", "e-m:e-Fn32-i64:64-v256:256-v512:512-n32:64-S128"},
+		{"e-m:x-p:32:32-i64:64-n8:16:32-a:0:32-S32", "e-m:x-p:32:32-i64:64-a:0:32-n8:16:32-S32"},
+	}
+	for _, testCase := range testCases {
+		dl, err := ParseDataLayout(testCase.layout)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, dl.LLString(), "layout %q", testCase.layout)
+	}
+	// An index size of zero is the pointer size.
+	dl := NewDataLayout("", "")
+	dl.PointerSizeAlignment[0] = NewPointerSizeAlignment(0, 32, 32, 32, 0)
+	dl.PointerSizeAlignment[1] = NewPointerSizeAlignment(1, 64, 64, 64, 0)
+	assert.Equal(t, "e-p:32:32-p1:64:64", dl.LLString())
+}
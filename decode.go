@@ -0,0 +1,132 @@
+package irutil
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// DecodeConstant returns the constant of the given type with the raw bytes of
+// data, as laid out in memory according to the data layout; the inverse of
+// EncodeConstant. Arrays of i8 are decoded as character arrays, and padding
+// bytes are ignored. Pointers are decoded as null if zero, and as inttoptr
+// expressions of the address otherwise, as relocations are not known. The
+// default data layout of LLVM is used if dl is nil.
+//
+// An error is returned if data is too short to hold a value of the type, or if
+// the type has no memory representation (e.g. opaque structs).
+func DecodeConstant(typ types.Type, data []byte, dl *DataLayout) (constant.Constant, error) {
+	if dl == nil {
+		dl = NewDataLayout("", "")
+	}
+	d := &decoder{dl: dl, buf: data}
+	return d.decode(typ, 0)
+}
+
+// decoder decodes constants from raw bytes.
+type decoder struct {
+	// Data layout of the target.
+	dl *DataLayout
+	// Encoded data.
+	buf []byte
+}
+
+// decode decodes the constant of the given type at the given offset of the
+// encoded data.
+func (d *decoder) decode(typ types.Type, off uint64) (constant.Constant, error) {
+	switch typ := typ.(type) {
+	case *types.IntType, *types.FloatType, *types.VectorType:
+		bits, err := d.getBits(typ, off)
+		if err != nil {
+			return nil, err
+		}
+		c := constantFromBits(bits, typ, d.dl.IsBigEndian)
+		if c == nil {
+			return nil, fmt.Errorf("support for decoding constant of type %v not yet implemented", typ)
+		}
+		return c, nil
+	case *types.PointerType:
+		bits, err := d.getBits(typ, off)
+		if err != nil {
+			return nil, err
+		}
+		if bits.Sign() == 0 {
+			return constant.NewNull(typ), nil
+		}
+		size := d.dl.pointerSizeAlignment(typ.AddrSpace).Size
+		addr := newInt(types.NewInt(size), bits)
+		return constant.NewIntToPtr(addr, typ), nil
+	case *types.ArrayType:
+		if typ.ElemType.Equal(types.I8) {
+			if err := d.check(typ, off); err != nil {
+				return nil, err
+			}
+			x := make([]byte, typ.Len)
+			copy(x, d.buf[off:])
+			return constant.NewCharArray(x), nil
+		}
+		elemSize, err := d.dl.TypeAllocSize(typ.ElemType)
+		if err != nil {
+			return nil, err
+		}
+		elems := make([]constant.Constant, typ.Len)
+		for i := range elems {
+			if elems[i], err = d.decode(typ.ElemType, off+uint64(i)*elemSize); err != nil {
+				return nil, err
+			}
+		}
+		return constant.NewArray(typ, elems...), nil
+	case *types.StructType:
+		offsets, _, _, err := d.dl.structFieldOffsets(typ)
+		if err != nil {
+			return nil, err
+		}
+		fields := make([]constant.Constant, len(typ.Fields))
+		for i, field := range typ.Fields {
+			if fields[i], err = d.decode(field, off+offsets[i]); err != nil {
+				return nil, err
+			}
+		}
+		return constant.NewStruct(typ, fields...), nil
+	default:
+		return nil, fmt.Errorf("unable to decode constant of type %v", typ)
+	}
+}
+
+// getBits returns the bits of the value of the given type at the given offset
+// of the encoded data, in the byte order of the target.
+func (d *decoder) getBits(typ types.Type, off uint64) (*big.Int, error) {
+	if err := d.check(typ, off); err != nil {
+		return nil, err
+	}
+	size, err := d.dl.TypeStoreSize(typ)
+	if err != nil {
+		return nil, err
+	}
+	src := d.buf[off : off+size]
+	// big.Int.SetBytes expects big-endian bytes.
+	b := make([]byte, size)
+	for i := range b {
+		if d.dl.IsBigEndian {
+			b[i] = src[i]
+		} else {
+			b[i] = src[size-1-uint64(i)]
+		}
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// check returns an error if the encoded data is too short to hold a value of
+// the given type at the given offset.
+func (d *decoder) check(typ types.Type, off uint64) error {
+	size, err := d.dl.TypeStoreSize(typ)
+	if err != nil {
+		return err
+	}
+	if n := uint64(len(d.buf)); off > n || size > n-off {
+		return fmt.Errorf("unable to decode constant of type %v at offset %d; data too short (%d bytes)", typ, off, len(d.buf))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeConstant(t *testing.T) {
+	le, err := NewDataLayoutForTriple("x86_64-unknown-linux-gnu")
+	require.NoError(t, err)
+	be, err := NewDataLayoutForTriple("mips-unknown-linux-gnu")
+	require.NoError(t, err)
+	st := types.NewStruct(types.I8, types.I32, types.I16)
+	testCases := []struct {
+		name string
+		typ  types.Type
+		dl   *DataLayout
+		data []byte
+		want string
+		// lossy reports whether the data is not reproduced by encoding the
+		// constant (e.g. padding bytes or addresses).
+		lossy bool
+	}{
+		{"IntLE", types.I32, le, []byte{4, 3, 2, 1}, "i32 16909060", false},
+		{"IntBE", types.I32, be, []byte{1, 2, 3, 4}, "i32 16909060", false},
+		{"NegativeInt", types.I16, le, []byte{0xFE, 0xFF}, "i16 -2", false},
+		{"I1", types.I1, le, []byte{1}, "i1 true", false},
+		{"Double", types.Double, le, []byte{0, 0, 0, 0, 0, 0, 0xF0, 0x3F}, "double 1.0", false},
+		{"FloatBE", types.Float, be, []byte{0x3F, 0x80, 0, 0}, "float 1.0", false},
+		{"CharArray", types.NewArray(3, types.I8), le, []byte{'h', 'i', 0}, `[3 x i8] c"hi\00"`, false},
+		{"Array", types.NewArray(2, types.I16), be, []byte{0, 1, 0, 2}, "[2 x i16] [i16 1, i16 2]", false},
+		{"Struct", st, le, []byte{1, 0xAA, 0xAA, 0xAA, 2, 0, 0, 0, 3, 0, 0xAA, 0xAA},
+			"{ i8, i32, i16 } { i8 1, i32 2, i16 3 }", true},
+		{"Vector", types.NewVector(4, types.I8), le, []byte{1, 2, 3, 4}, "<4 x i8> <i8 1, i8 2, i8 3, i8 4>", false},
+		{"VectorI1", types.NewVector(4, types.I1), le, []byte{0x0D}, "<4 x i1> <i1 true, i1 false, i1 true, i1 true>", false},
+		{"Null", types.I8Ptr, le, make([]byte, 8), "i8* null", false},
+		{"Address", types.I8Ptr, le, []byte{0x10, 0x20, 0, 0, 0, 0, 0, 0}, "i8* inttoptr (i64 8208 to i8*)", true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c, err := DecodeConstant(testCase.typ, testCase.data, testCase.dl)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.want, c.String())
+			// Decoding is the inverse of encoding.
+			if testCase.lossy {
+				return
+			}
+			data, _, err := EncodeConstant(c, testCase.dl)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.data, data)
+		})
+	}
+	_, err = DecodeConstant(types.I64, []byte{1, 2, 3}, le)
+	assert.Error(t, err)
+	opaque := types.NewStruct()
+	opaque.Opaque = true
+	_, err = DecodeConstant(opaque, nil, le)
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package irutil
+
+import (
+	"github.com/llir/llvm/ir"
+)
+
+// domTree is the dominator tree of a function.
+type domTree struct {
+	// Reachable basic blocks of the function in reverse postorder.
+	order []*ir.Block
+	// Reverse postorder index of reachable basic blocks.
+	index map[*ir.Block]int
+	// Predecessors of basic blocks.
+	preds map[*ir.Block][]*ir.Block
+	// Immediate dominator of reachable basic blocks; the entry basic block is
+	// its own immediate dominator.
+	idom map[*ir.Block]*ir.Block
+	// Children of basic blocks in the dominator tree.
+	children map[*ir.Block][]*ir.Block
+}
+
+// newDomTree returns the dominator tree of the given function definition.
+//
+// The dominator tree is computed using the iterative algorithm of Cooper,
+// Harvey and Kennedy, "A Simple, Fast Dominance Algorithm".
+func newDomTree(f *ir.Func) *domTree {
+	dt := &domTree{
+		index:    make(map[*ir.Block]int),
+		preds:    make(map[*ir.Block][]*ir.Block),
+		idom:     make(map[*ir.Block]*ir.Block),
+		children: make(map[*ir.Block][]*ir.Block),
+	}
+	if len(f.Blocks) == 0 {
+		return dt
+	}
+	// Compute reverse postorder of reachable basic blocks.
+	visited := make(map[*ir.Block]bool)
+	var post []*ir.Block
+	var dfs func(b *ir.Block)
+	dfs = func(b *ir.Block) {
+		visited[b] = true
+		for _, succ := range blockSuccs(b) {
+			dt.preds[succ] = append(dt.preds[succ], b)
+			if !visited[succ] {
+				dfs(succ)
+			}
+		}
+		post = append(post, b)
+	}
+	entry := f.Blocks[0]
+	dfs(entry)
+	for i := len(post) - 1; i >= 0; i-- {
+		dt.index[post[i]] = len(dt.order)
+		dt.order = append(dt.order, post[i])
+	}
+	// Compute immediate dominators.
+	dt.idom[entry] = entry
+	for changed := true; changed; {
+		changed = false
+		for _, b := range dt.order[1:] {
+			var newIdom *ir.Block
+			for _, pred := range dt.preds[b] {
+				if _, ok := dt.idom[pred]; !ok {
+					continue
+				}
+				if newIdom == nil {
+					newIdom = pred
+				} else {
+					newIdom = dt.intersect(pred, newIdom)
+				}
+			}
+			if dt.idom[b] != newIdom {
+				dt.idom[b] = newIdom
+				changed = true
+			}
+		}
+	}
+	for _, b := range dt.order[1:] {
+		parent := dt.idom[b]
+		dt.children[parent] = append(dt.children[parent], b)
+	}
+	return dt
+}
+
+// intersect returns the nearest common dominator of a and b.
+func (dt *domTree) intersect(a, b *ir.Block) *ir.Block {
+	for a != b {
+		for dt.index[a] > dt.index[b] {
+			a = dt.idom[a]
+		}
+		for dt.index[b] > dt.index[a] {
+			b = dt.idom[b]
+		}
+	}
+	return a
+}
+
+// reachable reports whether the basic block is reachable from the entry basic
+// block.
+func (dt *domTree) reachable(b *ir.Block) bool {
+	_, ok := dt.index[b]
+	return ok
+}
+
+// dominates reports whether the basic block a dominates the basic block b.
+func (dt *domTree) dominates(a, b *ir.Block) bool {
+	if !dt.reachable(a) || !dt.reachable(b) {
+		return false
+	}
+	for {
+		if a == b {
+			return true
+		}
+		parent := dt.idom[b]
+		if parent == b {
+			// reached entry basic block.
+			return false
+		}
+		b = parent
+	}
+}
+
+// blockSuccs returns the successor basic blocks of the given basic block.
+func blockSuccs(b *ir.Block) []*ir.Block {
+	// allow partial AST (terminator may not yet be set).
+	if b.Term == nil {
+		return nil
+	}
+	return b.Term.Succs()
+}
@@ -0,0 +1,198 @@
+package irutil
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// Relocation is a reference to the address of a global value within encoded
+// constant data. The bytes of the relocated value are zero in the encoded data.
+type Relocation struct {
+	// Offset in bytes of the relocated value from the start of the encoded
+	// data.
+	Offset uint64
+	// Size in bytes of the relocated value (e.g. the pointer size, or the size of
+	// the integer type of ptrtoint expressions).
+	Size uint64
+	// Referenced global value (*ir.Global, *ir.Func, *ir.Alias or *ir.IFunc).
+	Symbol constant.Constant
+	// Constant byte offset added to the address of the global value.
+	Addend int64
+}
+
+// EncodeConstant returns the raw bytes of the given constant, as laid out in
+// memory according to the data layout (e.g. as used for the initializer of a
+// global variable), and the relocations of addresses of global values within
+// the data. The size of the encoded data is the allocation size of the type of
+// the constant, and padding bytes and undefined values are zero. The default
+// data layout of LLVM is used if dl is nil.
+//
+// Constant expressions are simplified before being encoded, and addresses of
+// global values (including getelementptr and ptrtoint expressions with constant
+// offsets from global values) are encoded as relocations. An error is returned
+// if the constant contains other non-constant expressions.
+func EncodeConstant(c constant.Constant, dl *DataLayout) ([]byte, []Relocation, error) {
+	e := &encoder{s: newSimplifier(&SimplifyOptions{DataLayout: dl})}
+	size, err := e.s.dl.TypeAllocSize(c.Type())
+	if err != nil {
+		return nil, nil, err
+	}
+	e.buf = make([]byte, size)
+	if err := e.encode(c, 0); err != nil {
+		return nil, nil, err
+	}
+	return e.buf, e.relocs, nil
+}
+
+// encoder encodes constants as raw bytes.
+type encoder struct {
+	// Simplifier of constant expressions, using the data layout of the target.
+	s *simplifier
+	// Encoded data.
+	buf []byte
+	// Relocations of the encoded data.
+	relocs []Relocation
+}
+
+// encode encodes the constant c at the given offset of the encoded data.
+func (e *encoder) encode(c constant.Constant, off uint64) error {
+	c = e.s.simplify(c)
+	if e.s.err != nil {
+		return e.s.err
+	}
+	dl := e.s.dl
+	switch c := c.(type) {
+	case *constant.Int:
+		size, err := dl.TypeStoreSize(c.Typ)
+		if err != nil {
+			return err
+		}
+		e.putBits(off, size, toUnsigned(c.X, c.Typ.BitSize))
+	case *constant.Float:
+		bits, ok := floatBits(c)
+		if !ok {
+			return fmt.Errorf("support for encoding floating-point constant of type %v not yet implemented", c.Typ)
+		}
+		size, err := dl.TypeStoreSize(c.Typ)
+		if err != nil {
+			return err
+		}
+		e.putBits(off, size, bits)
+	case *constant.Null, *constant.ZeroInitializer, *constant.Undef, *constant.Poison:
+		// zero bytes.
+	case *constant.CharArray:
+		copy(e.buf[off:], c.X)
+	case *constant.Array:
+		elemSize, err := dl.TypeAllocSize(c.Typ.ElemType)
+		if err != nil {
+			return err
+		}
+		for i, elem := range c.Elems {
+			if err := e.encode(elem, off+uint64(i)*elemSize); err != nil {
+				return err
+			}
+		}
+	case *constant.Struct:
+		offsets, _, _, err := dl.structFieldOffsets(c.Typ)
+		if err != nil {
+			return err
+		}
+		for i, field := range c.Fields {
+			if err := e.encode(field, off+offsets[i]); err != nil {
+				return err
+			}
+		}
+	case *constant.Vector:
+		return e.encodeVector(c, off)
+	default:
+		return e.encodeReloc(c, off)
+	}
+	return nil
+}
+
+// encodeVector encodes the vector constant c at the given offset of the
+// encoded data. The elements of vectors are packed without padding; e.g. the
+// elements of <8 x i1> occupy a single byte.
+func (e *encoder) encodeVector(c *constant.Vector, off uint64) error {
+	dl := e.s.dl
+	if _, ok := c.Typ.ElemType.(*types.PointerType); ok {
+		elemSize, err := dl.TypeStoreSize(c.Typ.ElemType)
+		if err != nil {
+			return err
+		}
+		for i, elem := range c.Elems {
+			if err := e.encode(elem, off+uint64(i)*elemSize); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	elems, _ := e.s.aggregateElems(c)
+	if e.s.err != nil {
+		return e.s.err
+	}
+	for i, elem := range elems {
+		if isUndef(elem) || isPoison(elem) {
+			elems[i] = zeroElem(c.Typ.ElemType)
+		}
+	}
+	bits, ok := constantBits(constant.NewVector(c.Typ, elems...), dl.IsBigEndian)
+	if !ok {
+		return fmt.Errorf("unable to encode non-constant vector %v", c.Ident())
+	}
+	size, err := dl.TypeStoreSize(c.Typ)
+	if err != nil {
+		return err
+	}
+	e.putBits(off, size, bits)
+	return nil
+}
+
+// encodeReloc encodes the address of a global value (or integer derived from
+// an address) c at the given offset of the encoded data as a relocation.
+func (e *encoder) encodeReloc(c constant.Constant, off uint64) error {
+	var (
+		symbol constant.Constant
+		addend *big.Int
+		ok     bool
+	)
+	switch c.Type().(type) {
+	case *types.PointerType:
+		symbol, addend, ok = e.s.symbolicAddr(c)
+	case *types.IntType:
+		symbol, addend, ok = e.s.symbolicInt(c)
+	}
+	if !ok {
+		return fmt.Errorf("unable to encode non-constant expression %v", c.Ident())
+	}
+	if !addend.IsInt64() {
+		return fmt.Errorf("addend %v of relocation of %v out of range", addend, symbol.Ident())
+	}
+	size, err := e.s.dl.TypeStoreSize(c.Type())
+	if err != nil {
+		return err
+	}
+	e.relocs = append(e.relocs, Relocation{Offset: off, Size: size, Symbol: symbol, Addend: addend.Int64()})
+	return nil
+}
+
+// putBits stores the given bits as a size-byte value at the given offset of the
+// encoded data, in the byte order of the target.
+func (e *encoder) putBits(off, size uint64, bits *big.Int) {
+	b := bits.Bytes()
+	// b is big-endian; truncate to the size of the value.
+	if uint64(len(b)) > size {
+		b = b[uint64(len(b))-size:]
+	}
+	dst := e.buf[off : off+size]
+	for i := range b {
+		if e.s.dl.IsBigEndian {
+			dst[size-1-uint64(i)] = b[len(b)-1-i]
+		} else {
+			dst[i] = b[len(b)-1-i]
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeConstant(t *testing.T) {
+	le, err := NewDataLayoutForTriple("x86_64-unknown-linux-gnu")
+	require.NoError(t, err)
+	be, err := NewDataLayoutForTriple("mips-unknown-linux-gnu")
+	require.NoError(t, err)
+	i32 := func(x int64) constant.Constant { return constant.NewInt(types.I32, x) }
+	i8 := func(x int64) constant.Constant { return constant.NewInt(types.I8, x) }
+	st := types.NewStruct(types.I8, types.I32, types.I16)
+	testCases := []struct {
+		name string
+		c    constant.Constant
+		dl   *DataLayout
+		want []byte
+	}{
+		{"IntLE", i32(0x01020304), le, []byte{4, 3, 2, 1}},
+		{"IntBE", i32(0x01020304), be, []byte{1, 2, 3, 4}},
+		{"NegativeInt", constant.NewInt(types.I16, -2), le, []byte{0xFE, 0xFF}},
+		{"I1", constant.True, le, []byte{1}},
+		{"I24", constant.NewInt(types.NewInt(24), 0x010203), le, []byte{3, 2, 1, 0}},
+		{"Double", constant.NewFloat(types.Double, 1), le, []byte{0, 0, 0, 0, 0, 0, 0xF0, 0x3F}},
+		{"FloatBE", constant.NewFloat(types.Float, 1), be, []byte{0x3F, 0x80, 0, 0}},
+		{"CharArray", constant.NewCharArrayFromString("hi\x00"), le, []byte{'h', 'i', 0}},
+		{"Array", constant.NewArray(types.NewArray(2, types.I16), constant.NewInt(types.I16, 1), constant.NewInt(types.I16, 2)), be, []byte{0, 1, 0, 2}},
+		{"Struct", constant.NewStruct(st, i8(1), i32(2), constant.NewInt(types.I16, 3)), le,
+			[]byte{1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0}},
+		{"Vector", constant.NewVector(types.NewVector(4, types.I8), i8(1), i8(2), constant.NewUndef(types.I8), i8(4)), le, []byte{1, 2, 0, 4}},
+		{"VectorI1", constant.NewVector(types.NewVector(4, types.I1), constant.True, constant.False, constant.True, constant.True), le, []byte{0x0D}},
+		{"ZeroInitializer", constant.NewZeroInitializer(st), le, make([]byte, 12)},
+		{"Expr", constant.NewAdd(i32(1), i32(2)), le, []byte{3, 0, 0, 0}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got, relocs, err := EncodeConstant(testCase.c, testCase.dl)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.want, got)
+			assert.Empty(t, relocs)
+		})
+	}
+}
+
+func TestEncodeConstantRelocations(t *testing.T) {
+	dl, err := NewDataLayoutForTriple("x86_64-unknown-linux-gnu")
+	require.NoError(t, err)
+	m := ir.NewModule()
+	g := m.NewGlobalDef("g", constant.NewArray(types.NewArray(4, types.I32), constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 0)))
+	f := m.NewFunc("f", types.Void)
+	elem := constant.NewGetElementPtr(g.ContentType, g, constant.NewInt(types.I64, 0), constant.NewInt(types.I64, 2))
+	st := types.NewStruct(types.I32, types.I8Ptr, f.Type(), types.I64)
+	c := constant.NewStruct(st,
+		constant.NewInt(types.I32, -1),
+		constant.NewBitCast(elem, types.I8Ptr),
+		f,
+		constant.NewPtrToInt(g, types.I64),
+	)
+	got, relocs, err := EncodeConstant(c, dl)
+	require.NoError(t, err)
+	want := make([]byte, 32)
+	copy(want, []byte{0xFF, 0xFF, 0xFF, 0xFF})
+	assert.Equal(t, want, got)
+	assert.Equal(t, []Relocation{
+		{Offset: 8, Size: 8, Symbol: g, Addend: 8},
+		{Offset: 16, Size: 8, Symbol: f},
+		{Offset: 24, Size: 8, Symbol: g},
+	}, relocs)
+
+	// Truncated addresses are relocated with the size of the integer type.
+	_, relocs, err = EncodeConstant(constant.NewPtrToInt(g, types.I32), dl)
+	require.NoError(t, err)
+	assert.Equal(t, []Relocation{{Offset: 0, Size: 4, Symbol: g}}, relocs)
+	// Non-constant expressions cannot be encoded.
+	_, _, err = EncodeConstant(constant.NewMul(constant.NewPtrToInt(g, types.I64), constant.NewInt(types.I64, 2)), dl)
+	assert.Error(t, err)
+}
@@ -0,0 +1,220 @@
+package irutil
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// foldExtractValue returns the constant folded result of the extractvalue
+// expression. The original constant expression is returned if not foldable.
+func (s *simplifier) foldExtractValue(c *constant.ExprExtractValue) constant.Constant {
+	x := s.simplify(c.X)
+	for _, index := range c.Indices {
+		elems, ok := s.aggregateElems(x)
+		if !ok || index >= uint64(len(elems)) {
+			return c
+		}
+		x = elems[index]
+	}
+	return x
+}
+
+// foldInsertValue returns the constant folded result of the insertvalue
+// expression. The original constant expression is returned if not foldable.
+func (s *simplifier) foldInsertValue(c *constant.ExprInsertValue) constant.Constant {
+	if z := s.insertValue(s.simplify(c.X), s.simplify(c.Elem), c.Indices); z != nil {
+		return z
+	}
+	return c
+}
+
+// insertValue returns a copy of the aggregate constant x with the element at
+// the given indices replaced by elem, or nil if not foldable.
+func (s *simplifier) insertValue(x, elem constant.Constant, indices []uint64) constant.Constant {
+	if len(indices) == 0 {
+		return elem
+	}
+	elems, ok := s.aggregateElems(x)
+	if !ok || indices[0] >= uint64(len(elems)) {
+		return nil
+	}
+	e := s.insertValue(elems[indices[0]], elem, indices[1:])
+	if e == nil {
+		return nil
+	}
+	elems[indices[0]] = e
+	return newAggregate(x.Type(), elems)
+}
+
+// foldExtractElement returns the constant folded result of the extractelement
+// expression. A poison value is returned if the index is out of bounds or
+// undefined. The original constant expression is returned if not foldable.
+func (s *simplifier) foldExtractElement(c *constant.ExprExtractElement) constant.Constant {
+	if idx := s.simplify(c.Index); isUndef(idx) || isPoison(idx) {
+		return constant.NewPoison(c.Type())
+	}
+	elems, ok := s.vectorElems(s.simplify(c.X))
+	index, ok2 := s.simplify(c.Index).(*constant.Int)
+	if !ok || !ok2 {
+		return c
+	}
+	i := toUnsigned(index.X, index.Typ.BitSize)
+	if !i.IsUint64() || i.Uint64() >= uint64(len(elems)) {
+		return constant.NewPoison(c.Type())
+	}
+	return elems[i.Uint64()]
+}
+
+// foldInsertElement returns the constant folded result of the insertelement
+// expression. A poison value is returned if the index is out of bounds or
+// undefined. The original constant expression is returned if not foldable.
+func (s *simplifier) foldInsertElement(c *constant.ExprInsertElement) constant.Constant {
+	x := s.simplify(c.X)
+	if idx := s.simplify(c.Index); isUndef(idx) || isPoison(idx) {
+		return constant.NewPoison(x.Type())
+	}
+	elems, ok := s.vectorElems(x)
+	index, ok2 := s.simplify(c.Index).(*constant.Int)
+	if !ok || !ok2 {
+		return c
+	}
+	i := toUnsigned(index.X, index.Typ.BitSize)
+	if !i.IsUint64() || i.Uint64() >= uint64(len(elems)) {
+		return constant.NewPoison(x.Type())
+	}
+	elems[i.Uint64()] = s.simplify(c.Elem)
+	return newAggregate(x.Type(), elems)
+}
+
+// foldShuffleVector returns the constant folded result of the shufflevector
+// expression. Undefined and poison mask elements result in poison elements.
+// The original constant expression is returned if not foldable.
+func (s *simplifier) foldShuffleVector(c *constant.ExprShuffleVector) constant.Constant {
+	xs, ok := s.vectorElems(s.simplify(c.X))
+	ys, ok2 := s.vectorElems(s.simplify(c.Y))
+	mask, ok3 := s.vectorElems(s.simplify(c.Mask))
+	if !ok || !ok2 || !ok3 || len(mask) == 0 {
+		return c
+	}
+	elemType := c.X.Type().(*types.VectorType).ElemType
+	elems := make([]constant.Constant, len(mask))
+	for i, m := range mask {
+		switch m := m.(type) {
+		case *constant.Undef, *constant.Poison:
+			elems[i] = constant.NewPoison(elemType)
+		case *constant.Int:
+			j := toUnsigned(m.X, m.Typ.BitSize)
+			switch {
+			case !j.IsUint64() || j.Uint64() >= uint64(len(xs)+len(ys)):
+				return c
+			case j.Uint64() < uint64(len(xs)):
+				elems[i] = xs[j.Uint64()]
+			default:
+				elems[i] = ys[j.Uint64()-uint64(len(xs))]
+			}
+		default:
+			return c
+		}
+	}
+	return constant.NewVector(types.NewVector(uint64(len(elems)), elemType), elems...)
+}
+
+// aggregateElems returns the simplified elements of the given struct, array or
+// vector constant. Zero initializers, undefined values and poison values of
+// aggregate type are expanded to their elements. The boolean return value
+// reports whether c is an aggregate constant.
+func (s *simplifier) aggregateElems(c constant.Constant) ([]constant.Constant, bool) {
+	var elems []constant.Constant
+	switch c := c.(type) {
+	case *constant.Struct:
+		elems = append(elems, c.Fields...)
+	case *constant.Array:
+		elems = append(elems, c.Elems...)
+	case *constant.Vector:
+		elems = append(elems, c.Elems...)
+	case *constant.CharArray:
+		for _, b := range c.X {
+			elems = append(elems, constant.NewInt(types.I8, int64(int8(b))))
+		}
+		return elems, true
+	case *constant.ZeroInitializer:
+		return expandElems(c.Typ, zeroElem)
+	case *constant.Undef:
+		return expandElems(c.Typ, func(typ types.Type) constant.Constant {
+			return constant.NewUndef(typ)
+		})
+	case *constant.Poison:
+		return expandElems(c.Typ, func(typ types.Type) constant.Constant {
+			return constant.NewPoison(typ)
+		})
+	default:
+		return nil, false
+	}
+	for i, elem := range elems {
+		elems[i] = s.simplify(elem)
+	}
+	return elems, true
+}
+
+// expandElems returns the elements of the given aggregate type, as created by
+// newElem for each element type. The boolean return value reports whether typ
+// is an aggregate type.
+func expandElems(typ types.Type, newElem func(typ types.Type) constant.Constant) ([]constant.Constant, bool) {
+	var elemTypes []types.Type
+	switch typ := typ.(type) {
+	case *types.StructType:
+		elemTypes = typ.Fields
+	case *types.ArrayType:
+		for i := uint64(0); i < typ.Len; i++ {
+			elemTypes = append(elemTypes, typ.ElemType)
+		}
+	case *types.VectorType:
+		for i := uint64(0); i < typ.Len; i++ {
+			elemTypes = append(elemTypes, typ.ElemType)
+		}
+	default:
+		return nil, false
+	}
+	elems := make([]constant.Constant, len(elemTypes))
+	for i, elemType := range elemTypes {
+		elems[i] = newElem(elemType)
+	}
+	return elems, true
+}
+
+// newAggregate returns a new struct, array or vector constant of the given type
+// with the given elements. Arrays of i8 integer constants are represented as
+// character arrays.
+func newAggregate(typ types.Type, elems []constant.Constant) constant.Constant {
+	switch typ := typ.(type) {
+	case *types.StructType:
+		return constant.NewStruct(typ, elems...)
+	case *types.ArrayType:
+		if types.Equal(typ.ElemType, types.I8) {
+			buf := make([]byte, 0, len(elems))
+			for _, elem := range elems {
+				x, ok := elem.(*constant.Int)
+				if !ok {
+					return constant.NewArray(typ, elems...)
+				}
+				buf = append(buf, byte(x.X.Int64()))
+			}
+			return &constant.CharArray{Typ: typ, X: buf}
+		}
+		return constant.NewArray(typ, elems...)
+	case *types.VectorType:
+		return constant.NewVector(typ, elems...)
+	default:
+		panic(fmt.Errorf("support for aggregate type %T not yet implemented", typ))
+	}
+}
+
+// zeroElem returns the zero value of the given type; null for pointer types.
+func zeroElem(typ types.Type) constant.Constant {
+	if t, ok := typ.(*types.PointerType); ok {
+		return constant.NewNull(t)
+	}
+	return NewZero(typ).(constant.Constant)
+}
@@ -0,0 +1,311 @@
+package irutil
+
+import (
+	"math/big"
+	"math/bits"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// foldTrunc returns the constant folded result of truncating x to the given
+// integer type.
+func foldTrunc(x *constant.Int, to *types.IntType) constant.Constant {
+	return newInt(to, x.X)
+}
+
+// foldZExt returns the constant folded result of zero extending x to the given
+// integer type.
+func foldZExt(x *constant.Int, to *types.IntType) constant.Constant {
+	return newInt(to, toUnsigned(x.X, x.Typ.BitSize))
+}
+
+// foldSExt returns the constant folded result of sign extending x to the given
+// integer type.
+func foldSExt(x *constant.Int, to *types.IntType) constant.Constant {
+	return newInt(to, toSigned(x.X, x.Typ.BitSize))
+}
+
+// foldFPCast returns the constant folded result of converting x to the given
+// floating-point type (fptrunc or fpext), rounding to nearest even if the
+// value is not exactly representable.
+func foldFPCast(x *constant.Float, to *types.FloatType) constant.Constant {
+	switch {
+	case x.NaN:
+		z := newFloatNaN(to)
+		z.X.Copy(x.X)
+		return z
+	case isFloatInf(x):
+		return newFloatInf(to, signbit(x))
+	}
+	return roundFloat(to, toRat(x), signbit(x))
+}
+
+// foldFPToUI returns the constant folded result of converting x to an unsigned
+// integer of the given type, rounding towards zero. A poison value is returned
+// if x is NaN, infinite or out of range of the integer type.
+func foldFPToUI(x *constant.Float, to *types.IntType) constant.Constant {
+	return foldFPToInt(x, to, fitsUnsigned)
+}
+
+// foldFPToSI returns the constant folded result of converting x to a signed
+// integer of the given type, rounding towards zero. A poison value is returned
+// if x is NaN, infinite or out of range of the integer type.
+func foldFPToSI(x *constant.Float, to *types.IntType) constant.Constant {
+	return foldFPToInt(x, to, fitsSigned)
+}
+
+// foldFPToInt returns the constant folded result of converting x to an integer
+// of the given type, rounding towards zero. A poison value is returned if x is
+// NaN, infinite or if the integer value does not fit the integer type.
+func foldFPToInt(x *constant.Float, to *types.IntType, fits func(x *big.Int, bitSize uint64) bool) constant.Constant {
+	if x.NaN || isFloatInf(x) {
+		return constant.NewPoison(to)
+	}
+	// Int truncates towards zero.
+	z, _ := x.X.Int(nil)
+	if !fits(z, to.BitSize) {
+		return constant.NewPoison(to)
+	}
+	return newInt(to, z)
+}
+
+// foldUIToFP returns the constant folded result of converting the unsigned
+// integer x to the given floating-point type.
+func foldUIToFP(x *constant.Int, to *types.FloatType) constant.Constant {
+	return roundFloat(to, new(big.Rat).SetInt(toUnsigned(x.X, x.Typ.BitSize)), false)
+}
+
+// foldSIToFP returns the constant folded result of converting the signed
+// integer x to the given floating-point type.
+func foldSIToFP(x *constant.Int, to *types.FloatType) constant.Constant {
+	return roundFloat(to, new(big.Rat).SetInt(toSigned(x.X, x.Typ.BitSize)), false)
+}
+
+// foldBitCast returns the constant folded result of reinterpreting the bits of
+// the integer, floating-point or vector constant x as the given type of the
+// same bit size. The elements of vectors are laid out in memory order; i.e. the
+// first element occupies the least significant bits on little-endian targets
+// and the most significant bits on big-endian targets. A nil value is returned
+// if x is not foldable.
+func foldBitCast(x constant.Constant, to types.Type, bigEndian bool) constant.Constant {
+	size, ok := bitSizeOf(x.Type())
+	if toSize, ok2 := bitSizeOf(to); !ok || !ok2 || size != toSize {
+		return nil
+	}
+	bits, ok := constantBits(x, bigEndian)
+	if !ok {
+		return nil
+	}
+	return constantFromBits(bits, to, bigEndian)
+}
+
+// constantBits returns the bit representation of the integer, floating-point
+// or vector constant c. The boolean return value reports success.
+func constantBits(c constant.Constant, bigEndian bool) (*big.Int, bool) {
+	switch c := c.(type) {
+	case *constant.Int:
+		return toUnsigned(c.X, c.Typ.BitSize), true
+	case *constant.Float:
+		return floatBits(c)
+	case *constant.Vector:
+		z := new(big.Int)
+		for i, elem := range c.Elems {
+			elemSize, ok := bitSizeOf(elem.Type())
+			if !ok {
+				return nil, false
+			}
+			x, ok := constantBits(elem, bigEndian)
+			if !ok {
+				return nil, false
+			}
+			j := i
+			if bigEndian {
+				j = len(c.Elems) - 1 - i
+			}
+			z.Or(z, x.Lsh(x, uint(uint64(j)*elemSize)))
+		}
+		return z, true
+	case *constant.ZeroInitializer:
+		return new(big.Int), true
+	default:
+		return nil, false
+	}
+}
+
+// constantFromBits returns the integer, floating-point or vector constant of
+// the given type with the bit representation x. A nil value is returned if the
+// type is not supported.
+func constantFromBits(x *big.Int, typ types.Type, bigEndian bool) constant.Constant {
+	switch typ := typ.(type) {
+	case *types.IntType:
+		return newInt(typ, x)
+	case *types.FloatType:
+		z := floatFromBits(x, typ)
+		if z == nil {
+			return nil
+		}
+		return z
+	case *types.VectorType:
+		elemSize, ok := bitSizeOf(typ.ElemType)
+		if !ok {
+			return nil
+		}
+		mask := new(big.Int).Sub(pow2(elemSize), big.NewInt(1))
+		elems := make([]constant.Constant, typ.Len)
+		for i := range elems {
+			j := uint64(i)
+			if bigEndian {
+				j = typ.Len - 1 - uint64(i)
+			}
+			bits := new(big.Int).Rsh(x, uint(j*elemSize))
+			elem := constantFromBits(bits.And(bits, mask), typ.ElemType, bigEndian)
+			if elem == nil {
+				return nil
+			}
+			elems[i] = elem
+		}
+		return constant.NewVector(typ, elems...)
+	default:
+		return nil
+	}
+}
+
+// bitSizeOf returns the size in bits of the given integer, floating-point or
+// vector type. The boolean return value reports whether the type is supported.
+func bitSizeOf(typ types.Type) (uint64, bool) {
+	switch typ := typ.(type) {
+	case *types.IntType:
+		return typ.BitSize, true
+	case *types.FloatType:
+		return uint64(DefaultLayout{}.SizeOf(typ)), true
+	case *types.VectorType:
+		elemSize, ok := bitSizeOf(typ.ElemType)
+		return typ.Len * elemSize, ok
+	default:
+		return 0, false
+	}
+}
+
+// ieeeFormat returns the number of exponent bits and the number of stored
+// significand bits of the given floating-point kind, and reports whether the
+// leading integer bit of the significand is stored explicitly (as is the case
+// for x86_fp80). The boolean return value reports whether the bit
+// representation of the floating-point kind is supported.
+func ieeeFormat(kind types.FloatKind) (expBits, sigBits uint, explicit, ok bool) {
+	if kind == types.FloatKindPPC_FP128 {
+		// double-double arithmetic is not an IEEE 754 interchange format.
+		return 0, 0, false, false
+	}
+	prec, _, emax := floatFormat(kind)
+	expBits = uint(bits.Len(uint(2*emax + 1)))
+	if kind == types.FloatKindX86_FP80 {
+		return expBits, prec, true, true
+	}
+	return expBits, prec - 1, false, true
+}
+
+// floatBits returns the IEEE 754 bit representation of the floating-point
+// constant x. The boolean return value reports whether the floating-point kind
+// is supported.
+func floatBits(x *constant.Float) (*big.Int, bool) {
+	expBits, sigBits, explicit, ok := ieeeFormat(x.Typ.Kind)
+	if !ok {
+		return nil, false
+	}
+	prec, emin, emax := floatFormat(x.Typ.Kind)
+	bias := emax
+	maxExp := int64(1)<<expBits - 1
+	var exp int64
+	sig := new(big.Int)
+	switch {
+	case x.NaN:
+		// quiet NaN.
+		exp = maxExp
+		sig.SetBit(sig, int(prec)-2, 1)
+		if explicit {
+			sig.SetBit(sig, int(sigBits)-1, 1)
+		}
+	case isFloatInf(x):
+		exp = maxExp
+		if explicit {
+			sig.SetBit(sig, int(sigBits)-1, 1)
+		}
+	case isFloatZero(x):
+		// nothing to do.
+	default:
+		abs := new(big.Float).Abs(x.X)
+		e := abs.MantExp(nil) - 1
+		if e < emin {
+			// subnormal.
+			abs.SetMantExp(abs, int(prec)-1-emin)
+			sig, _ = abs.Int(nil)
+		} else {
+			exp = int64(e + bias)
+			abs.SetMantExp(abs, int(prec)-1-e)
+			sig, _ = abs.Int(nil)
+			if !explicit {
+				// clear implicit leading integer bit.
+				sig.SetBit(sig, int(sigBits), 0)
+			}
+		}
+	}
+	z := new(big.Int).Lsh(big.NewInt(exp), sigBits)
+	z.Or(z, sig)
+	if signbit(x) {
+		z.SetBit(z, int(expBits+sigBits), 1)
+	}
+	return z, true
+}
+
+// floatFromBits returns the floating-point constant of the given type with the
+// IEEE 754 bit representation x. A nil value is returned if the floating-point
+// kind is not supported.
+func floatFromBits(x *big.Int, typ *types.FloatType) *constant.Float {
+	expBits, sigBits, explicit, ok := ieeeFormat(typ.Kind)
+	if !ok {
+		return nil
+	}
+	prec, emin, emax := floatFormat(typ.Kind)
+	bias := emax
+	neg := x.Bit(int(expBits+sigBits)) == 1
+	sigMask := new(big.Int).Sub(pow2(uint64(sigBits)), big.NewInt(1))
+	sig := new(big.Int).And(x, sigMask)
+	exp := new(big.Int).Rsh(x, sigBits)
+	exp.SetBit(exp, int(expBits), 0)
+	maxExp := int64(1)<<expBits - 1
+	if explicit {
+		// ignore the explicit leading integer bit.
+		sig.SetBit(sig, int(sigBits)-1, 0)
+	}
+	switch exp.Int64() {
+	case maxExp:
+		if sig.Sign() != 0 {
+			z := newFloatNaN(typ)
+			if neg {
+				z.X.SetInt64(-1)
+			}
+			return z
+		}
+		return newFloatInf(typ, neg)
+	case 0:
+		// zero or subnormal.
+		r := new(big.Rat).SetFrac(sig, pow2(uint64(int(prec)-1-emin)))
+		if neg {
+			r.Neg(r)
+		}
+		return roundFloat(typ, r, neg)
+	default:
+		if !explicit {
+			sig.SetBit(sig, int(sigBits), 1)
+		} else {
+			sig.SetBit(sig, int(sigBits)-1, 1)
+		}
+		z := new(big.Float).SetPrec(prec).SetInt(sig)
+		z.SetMantExp(z, int(exp.Int64())-bias-(int(prec)-1))
+		if neg {
+			z.Neg(z)
+		}
+		return &constant.Float{Typ: typ, X: z}
+	}
+}
@@ -0,0 +1,82 @@
+package irutil
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+)
+
+// foldICmp returns the constant folded result of the integer comparison of x
+// and y using the given predicate.
+func foldICmp(pred enum.IPred, x, y *constant.Int) *constant.Int {
+	bitSize := x.Typ.BitSize
+	scmp := toSigned(x.X, bitSize).Cmp(toSigned(y.X, bitSize))
+	ucmp := toUnsigned(x.X, bitSize).Cmp(toUnsigned(y.X, bitSize))
+	switch pred {
+	case enum.IPredEQ:
+		return constant.NewBool(ucmp == 0)
+	case enum.IPredNE:
+		return constant.NewBool(ucmp != 0)
+	case enum.IPredSGE:
+		return constant.NewBool(scmp >= 0)
+	case enum.IPredSGT:
+		return constant.NewBool(scmp > 0)
+	case enum.IPredSLE:
+		return constant.NewBool(scmp <= 0)
+	case enum.IPredSLT:
+		return constant.NewBool(scmp < 0)
+	case enum.IPredUGE:
+		return constant.NewBool(ucmp >= 0)
+	case enum.IPredUGT:
+		return constant.NewBool(ucmp > 0)
+	case enum.IPredULE:
+		return constant.NewBool(ucmp <= 0)
+	case enum.IPredULT:
+		return constant.NewBool(ucmp < 0)
+	default:
+		panic(fmt.Errorf("support for integer comparison predicate %v not yet implemented", pred))
+	}
+}
+
+// foldFCmp returns the constant folded result of the floating-point comparison
+// of x and y using the given predicate. Ordered predicates evaluate to false and
+// unordered predicates evaluate to true if either operand is NaN.
+func foldFCmp(pred enum.FPred, x, y *constant.Float) *constant.Int {
+	switch pred {
+	case enum.FPredFalse:
+		return constant.False
+	case enum.FPredTrue:
+		return constant.True
+	}
+	if x.NaN || y.NaN {
+		switch pred {
+		case enum.FPredUEQ, enum.FPredUGE, enum.FPredUGT, enum.FPredULE, enum.FPredULT, enum.FPredUNE, enum.FPredUNO:
+			return constant.True
+		default:
+			return constant.False
+		}
+	}
+	// Cmp treats -0 and +0 as equal, as specified by IEEE 754.
+	cmp := x.X.Cmp(y.X)
+	switch pred {
+	case enum.FPredOEQ, enum.FPredUEQ:
+		return constant.NewBool(cmp == 0)
+	case enum.FPredOGE, enum.FPredUGE:
+		return constant.NewBool(cmp >= 0)
+	case enum.FPredOGT, enum.FPredUGT:
+		return constant.NewBool(cmp > 0)
+	case enum.FPredOLE, enum.FPredULE:
+		return constant.NewBool(cmp <= 0)
+	case enum.FPredOLT, enum.FPredULT:
+		return constant.NewBool(cmp < 0)
+	case enum.FPredONE, enum.FPredUNE:
+		return constant.NewBool(cmp != 0)
+	case enum.FPredORD:
+		return constant.True
+	case enum.FPredUNO:
+		return constant.False
+	default:
+		panic(fmt.Errorf("support for floating-point comparison predicate %v not yet implemented", pred))
+	}
+}
@@ -0,0 +1,218 @@
+package irutil
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// Floating-point constants are folded using exact rational arithmetic, and the
+// result is rounded to the precision of the floating-point type (round to
+// nearest, ties to even), as specified by IEEE 754. Results which overflow the
+// range of the floating-point type are rounded to infinity, and results in the
+// subnormal range are rounded to the reduced precision of subnormal numbers.
+
+// floatFormat returns the precision (including the leading integer bit) and
+// the minimum and maximum exponents of normal numbers of the given
+// floating-point kind.
+func floatFormat(kind types.FloatKind) (prec uint, emin, emax int) {
+	switch kind {
+	case types.FloatKindHalf:
+		return 11, -14, 15
+	case types.FloatKindFloat:
+		return 24, -126, 127
+	case types.FloatKindDouble:
+		return 53, -1022, 1023
+	case types.FloatKindFP128:
+		return 113, -16382, 16383
+	case types.FloatKindX86_FP80:
+		return 64, -16382, 16383
+	case types.FloatKindPPC_FP128:
+		// Double-double arithmetic is approximated by a 106-bit precision
+		// floating-point format with the exponent range of double.
+		return 106, -1022, 1023
+	default:
+		panic(fmt.Errorf("support for floating-point kind %v not yet implemented", kind))
+	}
+}
+
+// foldFloatAdd returns the constant folded result of x + y.
+func foldFloatAdd(x, y *constant.Float) *constant.Float {
+	typ := x.Typ
+	switch {
+	case x.NaN || y.NaN:
+		return newFloatNaN(typ)
+	case isFloatInf(x) && isFloatInf(y):
+		if signbit(x) != signbit(y) {
+			// inf + -inf
+			return newFloatNaN(typ)
+		}
+		return x
+	case isFloatInf(x):
+		return x
+	case isFloatInf(y):
+		return y
+	}
+	z := new(big.Rat).Add(toRat(x), toRat(y))
+	// The sum of two zeros of the same sign retains the sign; otherwise an
+	// exact zero sum is positive.
+	return roundFloat(typ, z, signbit(x) && signbit(y))
+}
+
+// foldFloatSub returns the constant folded result of x - y.
+func foldFloatSub(x, y *constant.Float) *constant.Float {
+	return foldFloatAdd(x, foldFloatNeg(y))
+}
+
+// foldFloatMul returns the constant folded result of x * y.
+func foldFloatMul(x, y *constant.Float) *constant.Float {
+	typ := x.Typ
+	neg := signbit(x) != signbit(y)
+	switch {
+	case x.NaN || y.NaN:
+		return newFloatNaN(typ)
+	case isFloatInf(x) || isFloatInf(y):
+		if isFloatZero(x) || isFloatZero(y) {
+			// inf * 0
+			return newFloatNaN(typ)
+		}
+		return newFloatInf(typ, neg)
+	}
+	z := new(big.Rat).Mul(toRat(x), toRat(y))
+	return roundFloat(typ, z, neg)
+}
+
+// foldFloatDiv returns the constant folded result of x / y. Division of a
+// non-zero value by zero results in an infinity, as specified by IEEE 754.
+func foldFloatDiv(x, y *constant.Float) *constant.Float {
+	typ := x.Typ
+	neg := signbit(x) != signbit(y)
+	switch {
+	case x.NaN || y.NaN:
+		return newFloatNaN(typ)
+	case isFloatInf(x) && isFloatInf(y):
+		return newFloatNaN(typ)
+	case isFloatInf(x):
+		return newFloatInf(typ, neg)
+	case isFloatInf(y):
+		return newFloatZero(typ, neg)
+	case isFloatZero(y):
+		if isFloatZero(x) {
+			// 0 / 0
+			return newFloatNaN(typ)
+		}
+		return newFloatInf(typ, neg)
+	}
+	z := new(big.Rat).Quo(toRat(x), toRat(y))
+	return roundFloat(typ, z, neg)
+}
+
+// foldFloatRem returns the constant folded result of the remainder of x / y,
+// with the sign of the dividend (as computed by fmod in libm).
+func foldFloatRem(x, y *constant.Float) *constant.Float {
+	typ := x.Typ
+	switch {
+	case x.NaN || y.NaN || isFloatInf(x) || isFloatZero(y):
+		return newFloatNaN(typ)
+	case isFloatInf(y):
+		return x
+	}
+	rx, ry := toRat(x), toRat(y)
+	// r = x - trunc(x/y)*y
+	q := new(big.Rat).Quo(rx, ry)
+	n := new(big.Int).Quo(q.Num(), q.Denom())
+	r := new(big.Rat).Mul(new(big.Rat).SetInt(n), ry)
+	r.Sub(rx, r)
+	return roundFloat(typ, r, signbit(x))
+}
+
+// foldFloatNeg returns the constant folded result of -x.
+func foldFloatNeg(x *constant.Float) *constant.Float {
+	return &constant.Float{Typ: x.Typ, X: new(big.Float).Neg(x.X), NaN: x.NaN}
+}
+
+// roundFloat returns a floating-point constant of the given type with the value
+// x rounded to the precision of the type. If x is zero, the sign of the zero is
+// determined by neg.
+func roundFloat(typ *types.FloatType, x *big.Rat, neg bool) *constant.Float {
+	if x.Sign() == 0 {
+		return newFloatZero(typ, neg)
+	}
+	neg = x.Sign() < 0
+	prec, emin, emax := floatFormat(typ.Kind)
+	// Truncation never increases the magnitude of x, thus the exponent is
+	// exact.
+	exp := new(big.Float).SetMode(big.ToZero).SetPrec(prec).SetRat(x).MantExp(nil) - 1
+	p := int(prec)
+	if exp < emin {
+		// subnormal; precision is reduced.
+		p -= emin - exp
+	}
+	if p <= 0 {
+		// |x| is less than the smallest subnormal number; round to either zero
+		// or the smallest subnormal number.
+		min := new(big.Rat).SetFrac(big.NewInt(1), pow2(uint64(-(emin - int(prec) + 1))))
+		half := new(big.Rat).Mul(min, big.NewRat(1, 2))
+		if new(big.Rat).Abs(x).Cmp(half) <= 0 {
+			// ties to even (i.e. zero).
+			return newFloatZero(typ, neg)
+		}
+		if neg {
+			min.Neg(min)
+		}
+		return &constant.Float{Typ: typ, X: new(big.Float).SetPrec(prec).SetRat(min)}
+	}
+	z := new(big.Float).SetMode(big.ToNearestEven).SetPrec(uint(p)).SetRat(x)
+	if z.MantExp(nil)-1 > emax {
+		return newFloatInf(typ, neg)
+	}
+	// Increasing precision is exact.
+	z.SetPrec(prec)
+	return &constant.Float{Typ: typ, X: z}
+}
+
+// toRat returns the exact rational value of the finite floating-point constant
+// x.
+func toRat(x *constant.Float) *big.Rat {
+	r, _ := x.X.Rat(nil)
+	return r
+}
+
+// newFloatNaN returns a (quiet) NaN floating-point constant of the given
+// type.
+func newFloatNaN(typ *types.FloatType) *constant.Float {
+	return &constant.Float{Typ: typ, X: &big.Float{}, NaN: true}
+}
+
+// newFloatInf returns a positive or negative infinity floating-point constant
+// of the given type.
+func newFloatInf(typ *types.FloatType, neg bool) *constant.Float {
+	return &constant.Float{Typ: typ, X: new(big.Float).SetInf(neg)}
+}
+
+// newFloatZero returns a positive or negative zero floating-point constant of
+// the given type.
+func newFloatZero(typ *types.FloatType, neg bool) *constant.Float {
+	z := new(big.Float)
+	if neg {
+		z.Neg(z)
+	}
+	return &constant.Float{Typ: typ, X: z}
+}
+
+// isFloatInf reports whether x is a positive or negative infinity.
+func isFloatInf(x *constant.Float) bool {
+	return !x.NaN && x.X.IsInf()
+}
+
+// isFloatZero reports whether x is a positive or negative zero.
+func isFloatZero(x *constant.Float) bool {
+	return !x.NaN && x.X.Sign() == 0
+}
+
+// signbit reports whether x is negative or negative zero.
+func signbit(x *constant.Float) bool {
+	return x.X != nil && x.X.Signbit()
+}
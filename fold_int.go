@@ -0,0 +1,255 @@
+package irutil
+
+import (
+	"math/big"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+)
+
+// Integer constants are folded using two's complement arithmetic, wrapping the
+// result to the bit size of the integer type. Folded integer constants are
+// represented in canonical form; i.e. as signed integers for integer types of
+// more than one bit, and as 0 or 1 for i1.
+
+// foldIntAdd returns the constant folded result of x + y. A poison value is
+// returned if the nsw or nuw overflow flags are violated.
+func foldIntAdd(x, y *constant.Int, flags []enum.OverflowFlag) constant.Constant {
+	return foldIntArith(x, y, flags, (*big.Int).Add)
+}
+
+// foldIntSub returns the constant folded result of x - y. A poison value is
+// returned if the nsw or nuw overflow flags are violated.
+func foldIntSub(x, y *constant.Int, flags []enum.OverflowFlag) constant.Constant {
+	return foldIntArith(x, y, flags, (*big.Int).Sub)
+}
+
+// foldIntMul returns the constant folded result of x * y. A poison value is
+// returned if the nsw or nuw overflow flags are violated.
+func foldIntMul(x, y *constant.Int, flags []enum.OverflowFlag) constant.Constant {
+	return foldIntArith(x, y, flags, (*big.Int).Mul)
+}
+
+// foldIntArith returns the constant folded result of the integer arithmetic
+// operation op on x and y. A poison value is returned if the nsw or nuw
+// overflow flags are violated.
+func foldIntArith(x, y *constant.Int, flags []enum.OverflowFlag, op func(z, x, y *big.Int) *big.Int) constant.Constant {
+	bitSize := x.Typ.BitSize
+	sx, sy := toSigned(x.X, bitSize), toSigned(y.X, bitSize)
+	for _, flag := range flags {
+		switch flag {
+		case enum.OverflowFlagNSW:
+			if z := op(new(big.Int), sx, sy); !fitsSigned(z, bitSize) {
+				return constant.NewPoison(x.Typ)
+			}
+		case enum.OverflowFlagNUW:
+			ux, uy := toUnsigned(x.X, bitSize), toUnsigned(y.X, bitSize)
+			if z := op(new(big.Int), ux, uy); !fitsUnsigned(z, bitSize) {
+				return constant.NewPoison(x.Typ)
+			}
+		}
+	}
+	return newInt(x.Typ, op(new(big.Int), sx, sy))
+}
+
+// foldIntUDiv returns the constant folded result of the unsigned division x /
+// y. A poison value is returned if exact is set and the remainder is non-zero.
+// Division by zero is undefined behaviour, in which case nil is returned.
+func foldIntUDiv(x, y *constant.Int, exact bool) constant.Constant {
+	bitSize := x.Typ.BitSize
+	ux, uy := toUnsigned(x.X, bitSize), toUnsigned(y.X, bitSize)
+	if uy.Sign() == 0 {
+		return nil
+	}
+	q, r := new(big.Int).QuoRem(ux, uy, new(big.Int))
+	if exact && r.Sign() != 0 {
+		return constant.NewPoison(x.Typ)
+	}
+	return newInt(x.Typ, q)
+}
+
+// foldIntSDiv returns the constant folded result of the signed division x / y,
+// rounded towards zero. A poison value is returned if exact is set and the
+// remainder is non-zero, or if the division overflows (e.g. -128 / -1 for
+// i8). Division by zero is undefined behaviour, in which case nil is returned.
+func foldIntSDiv(x, y *constant.Int, exact bool) constant.Constant {
+	bitSize := x.Typ.BitSize
+	sx, sy := toSigned(x.X, bitSize), toSigned(y.X, bitSize)
+	if sy.Sign() == 0 {
+		return nil
+	}
+	// Quo implements truncated division (as opposed to Euclidean division
+	// implemented by Div).
+	q, r := new(big.Int).QuoRem(sx, sy, new(big.Int))
+	if !fitsSigned(q, bitSize) {
+		return constant.NewPoison(x.Typ)
+	}
+	if exact && r.Sign() != 0 {
+		return constant.NewPoison(x.Typ)
+	}
+	return newInt(x.Typ, q)
+}
+
+// newInt returns a new integer constant of the given type with the value x
+// wrapped to the bit size of the type, in canonical form.
+func newInt(typ *types.IntType, x *big.Int) *constant.Int {
+	z := toUnsigned(x, typ.BitSize)
+	if typ.BitSize > 1 {
+		z = toSigned(z, typ.BitSize)
+	}
+	return &constant.Int{Typ: typ, X: z}
+}
+
+// toUnsigned returns the unsigned interpretation of the two's complement
+// integer x of the given bit size; i.e. x mod 2^bitSize.
+func toUnsigned(x *big.Int, bitSize uint64) *big.Int {
+	return new(big.Int).Mod(x, pow2(bitSize))
+}
+
+// toSigned returns the signed interpretation of the two's complement integer x
+// of the given bit size.
+func toSigned(x *big.Int, bitSize uint64) *big.Int {
+	z := toUnsigned(x, bitSize)
+	if bitSize > 0 && z.Bit(int(bitSize-1)) == 1 {
+		z.Sub(z, pow2(bitSize))
+	}
+	return z
+}
+
+// fitsSigned reports whether x is representable as a signed integer of the
+// given bit size.
+func fitsSigned(x *big.Int, bitSize uint64) bool {
+	return x.Cmp(toSigned(x, bitSize)) == 0
+}
+
+// fitsUnsigned reports whether x is representable as an unsigned integer of
+// the given bit size.
+func fitsUnsigned(x *big.Int, bitSize uint64) bool {
+	return x.Cmp(toUnsigned(x, bitSize)) == 0
+}
+
+// pow2 returns 2^n.
+func pow2(n uint64) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(n))
+}
+
+// foldIntURem returns the constant folded result of the unsigned remainder of
+// x / y. Division by zero is undefined behaviour, in which case nil is
+// returned.
+func foldIntURem(x, y *constant.Int) constant.Constant {
+	bitSize := x.Typ.BitSize
+	ux, uy := toUnsigned(x.X, bitSize), toUnsigned(y.X, bitSize)
+	if uy.Sign() == 0 {
+		return nil
+	}
+	return newInt(x.Typ, new(big.Int).Rem(ux, uy))
+}
+
+// foldIntSRem returns the constant folded result of the signed remainder of x
+// / y, with the sign of the dividend. A poison value is returned if the
+// division overflows (e.g. -128 % -1 for i8). Division by zero is undefined
+// behaviour, in which case nil is returned.
+func foldIntSRem(x, y *constant.Int) constant.Constant {
+	bitSize := x.Typ.BitSize
+	sx, sy := toSigned(x.X, bitSize), toSigned(y.X, bitSize)
+	if sy.Sign() == 0 {
+		return nil
+	}
+	q, r := new(big.Int).QuoRem(sx, sy, new(big.Int))
+	if !fitsSigned(q, bitSize) {
+		return constant.NewPoison(x.Typ)
+	}
+	return newInt(x.Typ, r)
+}
+
+// foldIntShl returns the constant folded result of x << y. A poison value is
+// returned if the shift amount is greater than or equal to the bit size, or if
+// the nsw or nuw overflow flags are violated; i.e. if any shifted out bit is
+// set (nuw) or differs from the sign bit of the result (nsw).
+func foldIntShl(x, y *constant.Int, flags []enum.OverflowFlag) constant.Constant {
+	bitSize := x.Typ.BitSize
+	k, ok := shiftAmount(y, bitSize)
+	if !ok {
+		return constant.NewPoison(x.Typ)
+	}
+	z := newInt(x.Typ, new(big.Int).Lsh(x.X, k))
+	for _, flag := range flags {
+		switch flag {
+		case enum.OverflowFlagNSW:
+			sx, sz := toSigned(x.X, bitSize), toSigned(z.X, bitSize)
+			if new(big.Int).Rsh(sz, k).Cmp(sx) != 0 {
+				return constant.NewPoison(x.Typ)
+			}
+		case enum.OverflowFlagNUW:
+			ux := toUnsigned(x.X, bitSize)
+			if !fitsUnsigned(new(big.Int).Lsh(ux, k), bitSize) {
+				return constant.NewPoison(x.Typ)
+			}
+		}
+	}
+	return z
+}
+
+// foldIntLShr returns the constant folded result of the logical right shift x
+// >> y. A poison value is returned if the shift amount is greater than or
+// equal to the bit size, or if exact is set and any shifted out bit is set.
+func foldIntLShr(x, y *constant.Int, exact bool) constant.Constant {
+	return foldIntShr(x, y, exact, toUnsigned)
+}
+
+// foldIntAShr returns the constant folded result of the arithmetic right shift
+// x >> y. A poison value is returned if the shift amount is greater than or
+// equal to the bit size, or if exact is set and any shifted out bit is set.
+func foldIntAShr(x, y *constant.Int, exact bool) constant.Constant {
+	return foldIntShr(x, y, exact, toSigned)
+}
+
+// foldIntShr returns the constant folded result of the right shift x >> y,
+// where x is interpreted as a signed or unsigned integer by conv.
+func foldIntShr(x, y *constant.Int, exact bool, conv func(x *big.Int, bitSize uint64) *big.Int) constant.Constant {
+	bitSize := x.Typ.BitSize
+	k, ok := shiftAmount(y, bitSize)
+	if !ok {
+		return constant.NewPoison(x.Typ)
+	}
+	// Rsh implements arithmetic shift for negative integers.
+	cx := conv(x.X, bitSize)
+	if exact && cx.TrailingZeroBits() < k && cx.Sign() != 0 {
+		return constant.NewPoison(x.Typ)
+	}
+	return newInt(x.Typ, new(big.Int).Rsh(cx, k))
+}
+
+// shiftAmount returns the shift amount y as an unsigned integer, and reports
+// whether it is less than the given bit size.
+func shiftAmount(y *constant.Int, bitSize uint64) (uint, bool) {
+	uy := toUnsigned(y.X, y.Typ.BitSize)
+	if !uy.IsUint64() || uy.Uint64() >= bitSize {
+		return 0, false
+	}
+	return uint(uy.Uint64()), true
+}
+
+// foldIntAnd returns the constant folded result of x & y.
+func foldIntAnd(x, y *constant.Int) constant.Constant {
+	return foldIntBitwise(x, y, (*big.Int).And)
+}
+
+// foldIntOr returns the constant folded result of x | y.
+func foldIntOr(x, y *constant.Int) constant.Constant {
+	return foldIntBitwise(x, y, (*big.Int).Or)
+}
+
+// foldIntXor returns the constant folded result of x ^ y.
+func foldIntXor(x, y *constant.Int) constant.Constant {
+	return foldIntBitwise(x, y, (*big.Int).Xor)
+}
+
+// foldIntBitwise returns the constant folded result of the bitwise operation op
+// on x and y.
+func foldIntBitwise(x, y *constant.Int, op func(z, x, y *big.Int) *big.Int) constant.Constant {
+	bitSize := x.Typ.BitSize
+	ux, uy := toUnsigned(x.X, bitSize), toUnsigned(y.X, bitSize)
+	return newInt(x.Typ, op(new(big.Int), ux, uy))
+}
@@ -0,0 +1,216 @@
+package irutil
+
+import (
+	"math/big"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+)
+
+// Symbolic folding handles constant expressions involving the addresses of
+// global values, which are not known until link time. Addresses are decomposed
+// into a global value (the base) and a constant byte offset, so that the
+// difference between two addresses of the same global value (as commonly found
+// in relocatable table initializers) and comparisons of addresses may be folded
+// without knowing the address of the global value.
+
+// foldSymbolicAdd returns the constant folded result of the add expression c
+// with non-constant operands. Chains of additions of integer constants are
+// reassociated; i.e. add(add(x, C1), C2) is folded to add(x, C1+C2). The
+// original constant expression is returned if no constant terms are combined.
+func (s *simplifier) foldSymbolicAdd(c *constant.ExprAdd) constant.Constant {
+	x, y := s.simplify(c.X), s.simplify(c.Y)
+	if _, ok := x.(*constant.Int); ok {
+		x, y = y, x
+	}
+	if c2, ok := y.(*constant.Int); ok {
+		if inner, ok := x.(*constant.ExprAdd); ok {
+			ix, iy := inner.X, inner.Y
+			if _, ok := ix.(*constant.Int); ok {
+				ix, iy = iy, ix
+			}
+			if c1, ok := iy.(*constant.Int); ok {
+				// overflow flags of the original expressions do not hold for
+				// the reassociated expression.
+				sum := newInt(c1.Typ, new(big.Int).Add(c1.X, c2.X))
+				if sum.X.Sign() == 0 {
+					return ix
+				}
+				return constant.NewAdd(ix, sum)
+			}
+		}
+		if c2.X.Sign() == 0 {
+			// x + 0
+			return x
+		}
+	}
+	return c
+}
+
+// foldSymbolicSub returns the constant folded result of the sub expression c
+// with non-constant operands. The difference between two integers derived from
+// addresses of the same global value is folded to the difference of their
+// offsets; e.g. sub(ptrtoint(gep @g, 8), ptrtoint @g) is folded to 8. The
+// original constant expression is returned if not foldable.
+func (s *simplifier) foldSymbolicSub(c *constant.ExprSub) constant.Constant {
+	typ, ok := c.Type().(*types.IntType)
+	if !ok {
+		return c
+	}
+	x, y := s.simplify(c.X), s.simplify(c.Y)
+	xbase, xoff, ok := s.symbolicInt(x)
+	if !ok {
+		return c
+	}
+	ybase, yoff, ok := s.symbolicInt(y)
+	if !ok || xbase != ybase {
+		return c
+	}
+	return newInt(typ, new(big.Int).Sub(xoff, yoff))
+}
+
+// foldSymbolicICmp returns the constant folded result of comparing the
+// simplified pointer operands x and y for equality. Addresses of the same
+// global value compare equal if and only if their offsets are equal, distinct
+// global values which are guaranteed to have distinct addresses compare
+// unequal, and global values which are guaranteed to be non-null compare
+// unequal to null. A nil value is returned if not foldable.
+func (s *simplifier) foldSymbolicICmp(pred enum.IPred, x, y constant.Constant) constant.Constant {
+	if pred != enum.IPredEQ && pred != enum.IPredNE {
+		return nil
+	}
+	result := func(equal bool) constant.Constant {
+		return constant.NewBool(equal == (pred == enum.IPredEQ))
+	}
+	if _, ok := x.(*constant.Null); ok {
+		x, y = y, x
+	}
+	xbase, xoff, ok := s.symbolicAddr(x)
+	if !ok {
+		return nil
+	}
+	if _, ok := y.(*constant.Null); ok {
+		if xoff.Sign() == 0 && isNonNull(xbase) {
+			return result(false)
+		}
+		return nil
+	}
+	ybase, yoff, ok := s.symbolicAddr(y)
+	if !ok {
+		return nil
+	}
+	if xbase == ybase {
+		// offsets wrap around the address space.
+		addrSpace := x.Type().(*types.PointerType).AddrSpace
+		size := s.indexSize(addrSpace)
+		return result(toUnsigned(xoff, size).Cmp(toUnsigned(yoff, size)) == 0)
+	}
+	// Addresses at non-zero offsets may refer to the end of one global value
+	// and the start of another.
+	if xoff.Sign() == 0 && yoff.Sign() == 0 && s.hasUniqueAddr(xbase) && s.hasUniqueAddr(ybase) {
+		return result(false)
+	}
+	return nil
+}
+
+// symbolicInt decomposes the integer constant c derived from an address into
+// its base global value and byte offset. The boolean return value reports
+// success.
+func (s *simplifier) symbolicInt(c constant.Constant) (base constant.Constant, off *big.Int, ok bool) {
+	switch c := c.(type) {
+	case *constant.ExprPtrToInt:
+		return s.symbolicAddr(c.From)
+	case *constant.ExprAdd:
+		x, y := c.X, c.Y
+		if _, ok := x.(*constant.Int); ok {
+			x, y = y, x
+		}
+		if y, ok := s.simplify(y).(*constant.Int); ok {
+			if base, off, ok := s.symbolicInt(s.simplify(x)); ok {
+				return base, off.Add(off, y.X), true
+			}
+		}
+	case *constant.ExprSub:
+		if y, ok := s.simplify(c.Y).(*constant.Int); ok {
+			if base, off, ok := s.symbolicInt(s.simplify(c.X)); ok {
+				return base, off.Sub(off, y.X), true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// symbolicAddr decomposes the pointer constant c into its base global value and
+// byte offset. The boolean return value reports success.
+func (s *simplifier) symbolicAddr(c constant.Constant) (base constant.Constant, off *big.Int, ok bool) {
+	switch c := c.(type) {
+	case *ir.Global, *ir.Func, *ir.Alias, *ir.IFunc:
+		return c, new(big.Int), true
+	case *constant.ExprBitCast:
+		return s.symbolicAddr(c.From)
+	case *constant.ExprGetElementPtr:
+		if _, ok := c.Type().(*types.PointerType); !ok {
+			// vector of pointers.
+			return nil, nil, false
+		}
+		base, off, ok := s.symbolicAddr(c.Src)
+		if !ok {
+			return nil, nil, false
+		}
+		delta, err := s.gepOffset(c)
+		if err != nil {
+			return nil, nil, false
+		}
+		return base, off.Add(off, delta), true
+	}
+	return nil, nil, false
+}
+
+// isNonNull reports whether the address of the given global value is
+// guaranteed to be non-null. Extern weak global values may be null, as may
+// aliases (which may refer to extern weak global values) and global values in
+// address spaces other than 0.
+func isNonNull(base constant.Constant) bool {
+	switch base := base.(type) {
+	case *ir.Global:
+		return base.Linkage != enum.LinkageExternWeak && base.Type().(*types.PointerType).AddrSpace == 0
+	case *ir.Func:
+		return base.Linkage != enum.LinkageExternWeak && base.Type().(*types.PointerType).AddrSpace == 0
+	default:
+		return false
+	}
+}
+
+// hasUniqueAddr reports whether the address of the given global value is
+// guaranteed to differ from the address of any other global value. Interposable
+// global values (e.g. weak definitions) may be replaced by other global values
+// at link time, unnamed_addr global values may be merged with other global
+// values, and zero-sized global variables may share the address of other global
+// values.
+func (s *simplifier) hasUniqueAddr(base constant.Constant) bool {
+	switch base := base.(type) {
+	case *ir.Global:
+		if isInterposable(base.Linkage) || base.UnnamedAddr == enum.UnnamedAddrUnnamedAddr {
+			return false
+		}
+		size, err := s.dl.TypeAllocSize(base.ContentType)
+		return err == nil && size > 0
+	case *ir.Func:
+		return !isInterposable(base.Linkage) && base.UnnamedAddr != enum.UnnamedAddrUnnamedAddr
+	default:
+		return false
+	}
+}
+
+// isInterposable reports whether global values with the given linkage may be
+// replaced by other definitions at link time.
+func isInterposable(linkage enum.Linkage) bool {
+	switch linkage {
+	case enum.LinkageWeak, enum.LinkageLinkOnce, enum.LinkageCommon, enum.LinkageExternWeak:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,186 @@
+package irutil
+
+import (
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+)
+
+// UndefPolicy specifies how undefined values are folded.
+//
+// Poison values are propagated regardless of policy; e.g. add poison, x =
+// poison.
+type UndefPolicy uint8
+
+// Undefined value policies.
+const (
+	// UndefPolicyLLVM chooses concrete values for undefined operands as LLVM
+	// does (e.g. opt -instsimplify); i.e. the value which makes the result
+	// simplest. For instance, undef & x = 0, undef | x = -1 and undef + x =
+	// undef.
+	UndefPolicyLLVM UndefPolicy = iota
+	// UndefPolicyZero treats undefined operands as zero.
+	UndefPolicyZero
+	// UndefPolicyPreserve leaves constant expressions with undefined operands
+	// unfolded.
+	UndefPolicyPreserve
+)
+
+// foldUndefBinary returns the constant folded result of the binary expression
+// c on the scalar operands x and y if either operand is poison, or if either
+// operand is undefined and the LLVM undefined value policy is in use. The
+// boolean return value reports whether the expression was folded.
+func (s *simplifier) foldUndefBinary(c constant.Expression, x, y constant.Constant) (constant.Constant, bool) {
+	typ := x.Type()
+	if isPoison(x) || isPoison(y) {
+		return constant.NewPoison(typ), true
+	}
+	xu, yu := isUndef(x), isUndef(y)
+	if !(xu || yu) || s.undef != UndefPolicyLLVM {
+		return nil, false
+	}
+	undef := constant.NewUndef(typ)
+	switch c.(type) {
+	case *constant.ExprAdd, *constant.ExprSub:
+		// undef + x = undef
+		return undef, true
+	case *constant.ExprXor:
+		if xu && yu {
+			// undef ^ undef = 0
+			return zeroElem(typ), true
+		}
+		return undef, true
+	case *constant.ExprAnd, *constant.ExprMul:
+		if xu && yu {
+			return undef, true
+		}
+		// undef & x = 0
+		return zeroElem(typ), true
+	case *constant.ExprOr:
+		if xu && yu {
+			return undef, true
+		}
+		// undef | x = -1
+		if t, ok := typ.(*types.IntType); ok {
+			return constant.NewInt(t, -1), true
+		}
+	case *constant.ExprUDiv, *constant.ExprSDiv, *constant.ExprURem, *constant.ExprSRem:
+		// x / undef = poison, as undef may be zero.
+		if yu || isZeroValue(y) {
+			return constant.NewPoison(typ), true
+		}
+		switch c.(type) {
+		case *constant.ExprUDiv, *constant.ExprSDiv:
+			if isOneValue(y) {
+				return undef, true
+			}
+		}
+		// undef / x = 0
+		return zeroElem(typ), true
+	case *constant.ExprShl, *constant.ExprLShr, *constant.ExprAShr:
+		// x << undef = poison, as undef may exceed the bit size.
+		if yu {
+			return constant.NewPoison(typ), true
+		}
+		if isZeroValue(y) {
+			return undef, true
+		}
+		// undef << x = 0
+		return zeroElem(typ), true
+	case *constant.ExprFAdd, *constant.ExprFSub, *constant.ExprFMul, *constant.ExprFDiv, *constant.ExprFRem:
+		if xu && yu {
+			return undef, true
+		}
+		// undef + x = NaN
+		if t, ok := typ.(*types.FloatType); ok {
+			return newFloatNaN(t), true
+		}
+	}
+	return nil, false
+}
+
+// foldUndefUnary returns the constant folded result of the unary or conversion
+// expression c on the scalar operand x of the given result type if x is
+// poison, or if x is undefined and the LLVM undefined value policy is in use.
+// The boolean return value reports whether the expression was folded.
+func (s *simplifier) foldUndefUnary(c constant.Expression, x constant.Constant, to types.Type) (constant.Constant, bool) {
+	if isPoison(x) {
+		return constant.NewPoison(to), true
+	}
+	if !isUndef(x) || s.undef != UndefPolicyLLVM {
+		return nil, false
+	}
+	switch c.(type) {
+	case *constant.ExprZExt, *constant.ExprSExt:
+		// The extended bits are all zero (or all equal to the sign bit).
+		return zeroElem(to), true
+	case *constant.ExprUIToFP, *constant.ExprSIToFP:
+		// The result is bounded.
+		return zeroElem(to), true
+	default:
+		return constant.NewUndef(to), true
+	}
+}
+
+// foldUndefCmp returns the constant folded result of the comparison expression
+// c on the scalar operands x and y if either operand is poison, or if either
+// operand is undefined and the LLVM undefined value policy is in use. The
+// boolean return value reports whether the expression was folded.
+func (s *simplifier) foldUndefCmp(c constant.Expression, x, y constant.Constant) (constant.Constant, bool) {
+	if isPoison(x) || isPoison(y) {
+		return constant.NewPoison(types.I1), true
+	}
+	xu, yu := isUndef(x), isUndef(y)
+	if !(xu || yu) || s.undef != UndefPolicyLLVM {
+		return nil, false
+	}
+	switch c := c.(type) {
+	case *constant.ExprICmp:
+		if c.Pred == enum.IPredEQ || c.Pred == enum.IPredNE || (xu && yu) {
+			// undef may be chosen to either pass or fail the comparison.
+			return constant.NewUndef(types.I1), true
+		}
+		// Choose the value of the other operand for undef.
+		switch c.Pred {
+		case enum.IPredSGE, enum.IPredSLE, enum.IPredUGE, enum.IPredULE:
+			return constant.True, true
+		default:
+			return constant.False, true
+		}
+	case *constant.ExprFCmp:
+		switch c.Pred {
+		case enum.FPredFalse:
+			return constant.False, true
+		case enum.FPredTrue:
+			return constant.True, true
+		// Choose NaN for undef, for which unordered comparisons succeed and
+		// ordered comparisons fail.
+		case enum.FPredUEQ, enum.FPredUGE, enum.FPredUGT, enum.FPredULE, enum.FPredULT, enum.FPredUNE, enum.FPredUNO:
+			return constant.True, true
+		default:
+			return constant.False, true
+		}
+	}
+	return nil, false
+}
+
+// concrete returns a concrete value for the given scalar constant if undefined
+// and the zero undefined value policy is in use, and c otherwise.
+func (s *simplifier) concrete(c constant.Constant) constant.Constant {
+	if isUndef(c) && s.undef == UndefPolicyZero {
+		return zeroElem(c.Type())
+	}
+	return c
+}
+
+// isUndef reports whether c is an undefined value.
+func isUndef(c constant.Constant) bool {
+	_, ok := c.(*constant.Undef)
+	return ok
+}
+
+// isPoison reports whether c is a poison value.
+func isPoison(c constant.Constant) bool {
+	_, ok := c.(*constant.Poison)
+	return ok
+}
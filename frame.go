@@ -0,0 +1,148 @@
+package irutil
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// FrameLayout specifies the layout of the static alloca instructions of a
+// function in its stack frame, as specified by a data layout. All offsets,
+// sizes and alignments are in bytes.
+//
+// The layout is an estimate of the stack usage of the function; code
+// generators may reorder, merge or eliminate stack slots, and spill slots,
+// callee-saved registers and outgoing arguments are not accounted for.
+type FrameLayout struct {
+	// Function of the stack frame.
+	Func *ir.Func
+	// Stack slots of static alloca instructions, in order of offset.
+	Slots []FrameSlot
+	// Size of the stack frame, rounded up to the alignment of the stack frame.
+	Size uint64
+	// Alignment of the stack frame; the maximum of the natural stack alignment
+	// and the alignments of the stack slots.
+	Align uint64
+	// Dynamic alloca instructions, which are not part of the static stack frame
+	// (i.e. allocas outside of the entry block or with a non-constant number of
+	// elements).
+	Dynamic []*ir.InstAlloca
+}
+
+// FrameSlot is the stack slot of a static alloca instruction.
+type FrameSlot struct {
+	// Alloca instruction of the stack slot.
+	Alloca *ir.InstAlloca
+	// Offset of the stack slot from the start of the stack frame.
+	Offset uint64
+	// Size of the stack slot; the allocation size of the element type times the
+	// number of elements.
+	Size uint64
+	// Alignment of the stack slot; the alignment of the alloca instruction if
+	// present, and the preferred alignment of the element type otherwise.
+	Align uint64
+}
+
+// Exceeds reports whether the stack usage of the function exceeds the given
+// budget in bytes. Functions with dynamic alloca instructions are considered to
+// exceed any budget, as their stack usage is unbounded.
+func (l *FrameLayout) Exceeds(budget uint64) bool {
+	return l.Size > budget || len(l.Dynamic) > 0
+}
+
+// FrameLayout returns the stack frame layout of the static alloca instructions
+// of the given function; i.e. allocas in the entry block with a constant number
+// of elements. Stack slots are laid out in program order, each aligned to the
+// alignment of the slot. An error is returned if an alloca is not in the alloca
+// address space of the data layout, or if its element type is unsized.
+func (dl *DataLayout) FrameLayout(f *ir.Func) (*FrameLayout, error) {
+	l := &FrameLayout{
+		Func:  f,
+		Align: dl.NaturalStackAlignment / 8,
+	}
+	if l.Align == 0 {
+		l.Align = 1
+	}
+	end := uint64(0)
+	for i, block := range f.Blocks {
+		for _, inst := range block.Insts {
+			alloca, ok := inst.(*ir.InstAlloca)
+			if !ok {
+				continue
+			}
+			if addrSpace := alloca.Type().(*types.PointerType).AddrSpace; uint64(addrSpace) != dl.AllocaAddressSpace {
+				return nil, fmt.Errorf("alloca %s in address space %d; expected alloca address space %d", alloca.Ident(), addrSpace, dl.AllocaAddressSpace)
+			}
+			n, ok := allocaNElems(alloca)
+			if i != 0 || !ok {
+				l.Dynamic = append(l.Dynamic, alloca)
+				continue
+			}
+			elemSize, err := dl.TypeAllocSize(alloca.ElemType)
+			if err != nil {
+				return nil, err
+			}
+			align := uint64(alloca.Align)
+			if align == 0 {
+				if align, err = dl.PrefAlignment(alloca.ElemType); err != nil {
+					return nil, err
+				}
+			}
+			slot := FrameSlot{
+				Alloca: alloca,
+				Offset: alignTo(end, align),
+				Size:   n * elemSize,
+				Align:  align,
+			}
+			l.Slots = append(l.Slots, slot)
+			end = slot.Offset + slot.Size
+			if align > l.Align {
+				l.Align = align
+			}
+		}
+	}
+	l.Size = alignTo(end, l.Align)
+	return l, nil
+}
+
+// FramesExceeding returns the stack frame layouts of the function definitions
+// of the given module which exceed the stack usage budget in bytes, in order of
+// occurrence.
+func (dl *DataLayout) FramesExceeding(m *ir.Module, budget uint64) ([]*FrameLayout, error) {
+	var frames []*FrameLayout
+	for _, f := range m.Funcs {
+		if len(f.Blocks) == 0 {
+			// skip function declarations.
+			continue
+		}
+		l, err := dl.FrameLayout(f)
+		if err != nil {
+			return nil, err
+		}
+		if l.Exceeds(budget) {
+			frames = append(frames, l)
+		}
+	}
+	return frames, nil
+}
+
+// allocaNElems returns the number of elements allocated by the given alloca
+// instruction. The number of elements is unsigned (e.g. i8 -56 is 200
+// elements). The boolean return value reports whether the number of elements
+// is constant.
+func allocaNElems(alloca *ir.InstAlloca) (uint64, bool) {
+	if alloca.NElems == nil {
+		return 1, true
+	}
+	n, ok := alloca.NElems.(*constant.Int)
+	if !ok {
+		return 0, false
+	}
+	x := toUnsigned(n.X, n.Typ.BitSize)
+	if !x.IsUint64() {
+		return 0, false
+	}
+	return x.Uint64(), true
+}
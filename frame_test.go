@@ -0,0 +1,78 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameLayout(t *testing.T) {
+	dl, err := NewDataLayoutForTriple("x86_64-unknown-linux-gnu")
+	require.NoError(t, err)
+	m := ir.NewModule()
+	n := ir.NewParam("n", types.I64)
+	f := m.NewFunc("f", types.Void, n)
+	entry := f.NewBlock("entry")
+	a := entry.NewAlloca(types.I8)
+	b := entry.NewAlloca(types.I32)
+	c := entry.NewAlloca(types.I8)
+	c.NElems = constant.NewInt(types.I32, 5)
+	d := entry.NewAlloca(types.Double)
+	d.Align = 32
+	// The number of elements is unsigned; i8 -56 is 200.
+	e := entry.NewAlloca(types.I8)
+	e.NElems = constant.NewInt(types.I8, -56)
+	vla := entry.NewAlloca(types.I32)
+	vla.NElems = n
+	exit := f.NewBlock("exit")
+	late := exit.NewAlloca(types.I64)
+	entry.NewBr(exit)
+	exit.NewRet(nil)
+
+	l, err := dl.FrameLayout(f)
+	require.NoError(t, err)
+	assert.Equal(t, []FrameSlot{
+		{Alloca: a, Offset: 0, Size: 1, Align: 1},
+		{Alloca: b, Offset: 4, Size: 4, Align: 4},
+		{Alloca: c, Offset: 8, Size: 5, Align: 1},
+		{Alloca: d, Offset: 32, Size: 8, Align: 32},
+		{Alloca: e, Offset: 40, Size: 200, Align: 1},
+	}, l.Slots)
+	assert.Equal(t, uint64(256), l.Size)
+	assert.Equal(t, uint64(32), l.Align)
+	assert.Equal(t, []*ir.InstAlloca{vla, late}, l.Dynamic)
+	assert.True(t, l.Exceeds(1024))
+
+	// The frame is aligned to the natural stack alignment.
+	g := m.NewFunc("g", types.Void)
+	gentry := g.NewBlock("")
+	gentry.NewAlloca(types.NewArray(20, types.I8))
+	gentry.NewRet(nil)
+	l, err = dl.FrameLayout(g)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(32), l.Size)
+	assert.Equal(t, uint64(16), l.Align)
+	assert.False(t, l.Exceeds(32))
+	assert.True(t, l.Exceeds(16))
+
+	frames, err := dl.FramesExceeding(m, 32)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, f, frames[0].Func)
+
+	// Allocas must be in the alloca address space.
+	amdgpu, err := ParseDataLayout("e-p5:32:32-A5")
+	require.NoError(t, err)
+	_, err = amdgpu.FrameLayout(g)
+	assert.Error(t, err)
+	alloca := gentry.Insts[0].(*ir.InstAlloca)
+	alloca.AddrSpace = 5
+	alloca.Typ = nil
+	l, err = amdgpu.FrameLayout(g)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), l.Size)
+}
@@ -0,0 +1,130 @@
+package irutil
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// OffsetOf returns the offset in bytes of the address computed by the given
+// getelementptr constant expression relative to its source address, as
+// specified by the data layout. The default data layout of LLVM is used if dl
+// is nil. An error is returned if any index is not a constant integer (after
+// simplification).
+func OffsetOf(gep *constant.ExprGetElementPtr, dl *DataLayout) (int64, error) {
+	s := newSimplifier(&SimplifyOptions{DataLayout: dl})
+	off, err := s.gepOffset(gep)
+	if err != nil {
+		return 0, err
+	}
+	if !off.IsInt64() {
+		return 0, fmt.Errorf("offset %v of getelementptr expression %v out of range", off, gep.Ident())
+	}
+	return off.Int64(), nil
+}
+
+// gepOffset returns the offset in bytes of the address computed by the given
+// getelementptr constant expression relative to its source address, wrapped to
+// the index width of the source address space.
+func (s *simplifier) gepOffset(gep *constant.ExprGetElementPtr) (*big.Int, error) {
+	srcType, ok := gep.Src.Type().(*types.PointerType)
+	if !ok {
+		return nil, fmt.Errorf("support for getelementptr source address of type %v not yet implemented", gep.Src.Type())
+	}
+	off := new(big.Int)
+	typ := gep.ElemType
+	for i, index := range gep.Indices {
+		if idx, ok := index.(*constant.Index); ok {
+			index = idx.Constant
+		}
+		x, ok := s.simplify(index).(*constant.Int)
+		if !ok {
+			return nil, fmt.Errorf("unable to compute offset of non-constant getelementptr index %v", index.Ident())
+		}
+		idx := toSigned(x.X, x.Typ.BitSize)
+		if i > 0 {
+			// The first index steps through the source address; the subsequent
+			// indices step into the indexed aggregate type.
+			switch t := typ.(type) {
+			case *types.StructType:
+				offsets, _, _, err := s.dl.structFieldOffsets(t)
+				if err != nil {
+					return nil, err
+				}
+				if !idx.IsInt64() || idx.Int64() < 0 || idx.Int64() >= int64(len(offsets)) {
+					return nil, fmt.Errorf("struct field index %v out of bounds for type %v", idx, t)
+				}
+				off.Add(off, new(big.Int).SetUint64(offsets[idx.Int64()]))
+				typ = t.Fields[idx.Int64()]
+				continue
+			case *types.ArrayType:
+				typ = t.ElemType
+			case *types.VectorType:
+				typ = t.ElemType
+			default:
+				return nil, fmt.Errorf("unable to index into non-aggregate type %v", typ)
+			}
+		}
+		size, err := s.dl.TypeAllocSize(typ)
+		if err != nil {
+			return nil, err
+		}
+		off.Add(off, idx.Mul(idx, new(big.Int).SetUint64(size)))
+	}
+	return toSigned(off, s.indexSize(srcType.AddrSpace)), nil
+}
+
+// foldGEP returns the constant folded result of the getelementptr expression.
+// If the indices are constant, the expression is canonicalized to a
+// getelementptr on i8 with the offset in bytes as its single index. If the
+// source address is null, the address is folded to an integer constant
+// converted to a pointer. The original constant expression is returned if not
+// foldable.
+func (s *simplifier) foldGEP(c *constant.ExprGetElementPtr) constant.Constant {
+	src := s.simplify(c.Src)
+	srcType, ok := src.Type().(*types.PointerType)
+	if !ok {
+		return c
+	}
+	resType, ok := c.Type().(*types.PointerType)
+	if !ok {
+		return c
+	}
+	off, err := s.gepOffset(c)
+	if err != nil {
+		return c
+	}
+	indexType := types.NewInt(s.indexSize(srcType.AddrSpace))
+	if _, ok := src.(*constant.Null); ok {
+		if off.Sign() == 0 {
+			return constant.NewNull(resType)
+		}
+		return constant.NewIntToPtr(newInt(indexType, off), resType)
+	}
+	if off.Sign() == 0 {
+		return s.simplify(constant.NewBitCast(src, resType))
+	}
+	if len(c.Indices) == 1 && types.Equal(c.ElemType, types.I8) && src == c.Src {
+		if _, ok := c.Indices[0].(*constant.Int); ok {
+			// already in canonical form.
+			return c
+		}
+	}
+	i8Ptr := types.NewPointer(types.I8)
+	i8Ptr.AddrSpace = srcType.AddrSpace
+	base := s.simplify(constant.NewBitCast(src, i8Ptr))
+	gep := constant.NewGetElementPtr(types.I8, base, newInt(indexType, off))
+	gep.InBounds = c.InBounds
+	if gep.Type().Equal(resType) {
+		return gep
+	}
+	return constant.NewBitCast(gep, resType)
+}
+
+// indexSize returns the size in bits of getelementptr indices for pointers in
+// the given address space.
+func (s *simplifier) indexSize(addrSpace types.AddrSpace) uint64 {
+	return s.dl.pointerSizeAlignment(addrSpace).IndexSize()
+}
@@ -0,0 +1,84 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsetOf(t *testing.T) {
+	i32 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I32, x)
+	}
+	i64 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I64, x)
+	}
+	st := types.NewStruct(types.I8, types.I32, types.NewArray(4, types.I16))
+	packed := types.NewStruct(types.I8, types.I32)
+	packed.Packed = true
+	wide := types.NewStruct(types.I32, types.I64)
+	g := ir.NewGlobal("g", st)
+	dl, err := NewDataLayoutFromString("e-i64:64", "", "")
+	require.NoError(t, err)
+	testCases := []struct {
+		name     string
+		expected int64
+		gep      *constant.ExprGetElementPtr
+		dl       *DataLayout
+	}{
+		{"Struct", 4, constant.NewGetElementPtr(st, g, i64(0), i32(1)), nil},
+		{"Array", 14, constant.NewGetElementPtr(st, g, i64(0), i32(2), i64(3)), nil},
+		{"Step", 32, constant.NewGetElementPtr(st, g, i64(2)), nil},
+		{"Negative", -16, constant.NewGetElementPtr(st, g, i64(-1)), nil},
+		{"Packed", 1, constant.NewGetElementPtr(packed, constant.NewNull(types.NewPointer(packed)), i64(0), i32(1)), nil},
+		{"DefaultI64Align", 4, constant.NewGetElementPtr(wide, constant.NewNull(types.NewPointer(wide)), i64(0), i32(1)), nil},
+		{"I64Align", 8, constant.NewGetElementPtr(wide, constant.NewNull(types.NewPointer(wide)), i64(0), i32(1)), dl},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			off, err := OffsetOf(testCase.gep, testCase.dl)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, off)
+		})
+	}
+	_, err = OffsetOf(constant.NewGetElementPtr(st, g, constant.NewPtrToInt(g, types.I64)), nil)
+	assert.Error(t, err)
+}
+
+func TestFoldGEP(t *testing.T) {
+	i32 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I32, x)
+	}
+	i64 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I64, x)
+	}
+	st := types.NewStruct(types.I8, types.I32, types.NewArray(4, types.I16))
+	g := ir.NewGlobal("g", st)
+	null := constant.NewNull(types.NewPointer(st))
+	testCases := []struct {
+		name     string
+		expected string
+		from     constant.Constant
+	}{
+		{"Canonical", "i32* bitcast (i8* getelementptr (i8, i8* bitcast ({ i8, i32, [4 x i16] }* @g to i8*), i64 4) to i32*)",
+			constant.NewGetElementPtr(st, g, i64(0), i32(1))},
+		{"ZeroOffset", "i8* bitcast ({ i8, i32, [4 x i16] }* @g to i8*)",
+			constant.NewGetElementPtr(st, g, i64(0), i32(0))},
+		{"Null", "{ i8, i32, [4 x i16] }* inttoptr (i64 16 to { i8, i32, [4 x i16] }*)",
+			constant.NewGetElementPtr(st, null, i64(1))},
+		{"NullZero", "i8* null", constant.NewGetElementPtr(st, null, i64(0), i32(0))},
+		{"SizeOf", "i64 16",
+			constant.NewPtrToInt(constant.NewGetElementPtr(st, null, i64(1)), types.I64)},
+		{"OffsetOf", "i64 14",
+			constant.NewPtrToInt(constant.NewGetElementPtr(st, null, i64(0), i32(2), i64(3)), types.I64)},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, Simplify(testCase.from).String())
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package irutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/enum"
+)
+
+// GlobalDCE removes the global variables, functions, aliases and IFuncs of
+// the module which are not reachable from the given root symbols (e.g. "main"
+// and exported names). Reachability is determined by walking the root symbols
+// using Walk.
+//
+// Global variables with appending linkage and a "llvm." name prefix (e.g.
+// llvm.used and llvm.global_ctors) are implicitly treated as roots, and the
+// members of a comdat are kept alive together.
+func GlobalDCE(m *ir.Module, roots []string) error {
+	live, err := liveGlobalValues(m, roots)
+	if err != nil {
+		return err
+	}
+	var globals []*ir.Global
+	for _, g := range m.Globals {
+		if live[g] {
+			globals = append(globals, g)
+		}
+	}
+	m.Globals = globals
+	var funcs []*ir.Func
+	for _, f := range m.Funcs {
+		if live[f] {
+			funcs = append(funcs, f)
+		}
+	}
+	m.Funcs = funcs
+	var aliases []*ir.Alias
+	for _, a := range m.Aliases {
+		if live[a] {
+			aliases = append(aliases, a)
+		}
+	}
+	m.Aliases = aliases
+	var ifuncs []*ir.IFunc
+	for _, i := range m.IFuncs {
+		if live[i] {
+			ifuncs = append(ifuncs, i)
+		}
+	}
+	m.IFuncs = ifuncs
+	return nil
+}
+
+// Internalize changes the linkage of the global variable, function, alias and
+// IFunc definitions of the module, except for the given root symbols, to
+// internal linkage.
+//
+// Declarations, definitions with local, appending or available_externally
+// linkage, and global values with a "llvm." name prefix are left unchanged.
+func Internalize(m *ir.Module, roots []string) {
+	isRoot := make(map[string]bool)
+	for _, root := range roots {
+		isRoot[root] = true
+	}
+	for _, v := range moduleGlobalValues(m) {
+		if v.IsUnnamed() || isRoot[v.Name()] || isDeclaration(v) || strings.HasPrefix(v.Name(), "llvm.") {
+			continue
+		}
+		switch linkageOf(v) {
+		case enum.LinkageInternal, enum.LinkagePrivate, enum.LinkageAppending, enum.LinkageAvailableExternally:
+			continue
+		}
+		setLinkage(v, enum.LinkageInternal)
+		// Symbols with local linkage must have default visibility.
+		switch v := v.(type) {
+		case *ir.Global:
+			v.Visibility = enum.VisibilityNone
+			v.DLLStorageClass = enum.DLLStorageClassNone
+		case *ir.Func:
+			v.Visibility = enum.VisibilityNone
+			v.DLLStorageClass = enum.DLLStorageClassNone
+		case *ir.Alias:
+			v.Visibility = enum.VisibilityNone
+			v.DLLStorageClass = enum.DLLStorageClassNone
+		case *ir.IFunc:
+			v.Visibility = enum.VisibilityNone
+			v.DLLStorageClass = enum.DLLStorageClassNone
+		}
+	}
+}
+
+// liveGlobalValues returns the set of global values of the module reachable
+// from the given root symbols.
+func liveGlobalValues(m *ir.Module, roots []string) (map[globalValue]bool, error) {
+	syms := make(map[string]globalValue)
+	comdatMembers := make(map[*ir.ComdatDef][]globalValue)
+	for _, v := range moduleGlobalValues(m) {
+		if !v.IsUnnamed() {
+			syms[v.Name()] = v
+		}
+		if c := comdatOf(v); c != nil {
+			comdatMembers[c] = append(comdatMembers[c], v)
+		}
+	}
+	var queue []globalValue
+	for _, root := range roots {
+		v, ok := syms[root]
+		if !ok {
+			return nil, fmt.Errorf("unable to locate root symbol %q", root)
+		}
+		queue = append(queue, v)
+	}
+	for _, g := range m.Globals {
+		if g.Linkage == enum.LinkageAppending && strings.HasPrefix(g.Name(), "llvm.") {
+			queue = append(queue, g)
+		}
+	}
+	live := make(map[globalValue]bool)
+	visit := func(n interface{}) bool {
+		v, ok := n.(globalValue)
+		if !ok {
+			return true
+		}
+		if live[v] {
+			return false
+		}
+		live[v] = true
+		if c := comdatOf(v); c != nil {
+			queue = append(queue, comdatMembers[c]...)
+		}
+		return true
+	}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		if live[v] {
+			continue
+		}
+		Walk(v, visit)
+	}
+	return live, nil
+}
+
+// comdatOf returns the comdat of the given global value, or nil if not
+// present.
+func comdatOf(v globalValue) *ir.ComdatDef {
+	switch v := v.(type) {
+	case *ir.Global:
+		return v.Comdat
+	case *ir.Func:
+		return v.Comdat
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,53 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir/enum"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobalDCE(t *testing.T) {
+	src := `
+@used = global i32 0
+@unused = global i32 1
+@llvm.used = appending global [1 x i8*] [i8* bitcast (i32* @kept to i8*)]
+@kept = global i32 2
+
+declare void @unused_decl()
+
+define i32 @helper() {
+	%x = load i32, i32* @used
+	ret i32 %x
+}
+
+define void @dead() {
+	call void @unused_decl()
+	ret void
+}
+
+define i32 @main() {
+	%x = call i32 @helper()
+	ret i32 %x
+}
+`
+	m := parseModule(t, "a.ll", src)
+	require.NoError(t, GlobalDCE(m, []string{"main"}))
+	var names []string
+	for _, v := range moduleGlobalValues(m) {
+		names = append(names, v.Name())
+	}
+	assert.Equal(t, []string{"used", "llvm.used", "kept", "helper", "main"}, names)
+
+	Internalize(m, []string{"main"})
+	for _, f := range m.Funcs {
+		switch f.Name() {
+		case "main":
+			assert.Equal(t, enum.LinkageNone, f.Linkage)
+		case "helper":
+			assert.Equal(t, enum.LinkageInternal, f.Linkage)
+		}
+	}
+	assert.Error(t, GlobalDCE(m, []string{"missing"}))
+}
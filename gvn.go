@@ -0,0 +1,57 @@
+package irutil
+
+import (
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/value"
+)
+
+// GVN performs global value numbering on the given function definition,
+// replacing pure instructions which are equivalent to (as determined by
+// InstKey) and dominated by an earlier instruction with the earlier
+// instruction. The redundant instructions are removed, and the number of
+// removed instructions is returned.
+func GVN(f *ir.Func) int {
+	if len(f.Blocks) == 0 {
+		return 0
+	}
+	dt := newDomTree(f)
+	repl := make(map[value.Value]value.Value)
+	resolve := func(v value.Value) value.Value {
+		if leader, ok := repl[v]; ok {
+			return leader
+		}
+		return v
+	}
+	// Available leaders, keyed by structural key; scoped by the dominator
+	// tree.
+	avail := make(map[string]value.Value)
+	var visit func(b *ir.Block)
+	visit = func(b *ir.Block) {
+		var added []string
+		insts := b.Insts[:0]
+		for _, inst := range b.Insts {
+			key, ok := instKey(inst, resolve)
+			if !ok {
+				insts = append(insts, inst)
+				continue
+			}
+			if leader, ok := avail[key]; ok {
+				repl[inst.(value.Value)] = leader
+				continue
+			}
+			avail[key] = inst.(value.Value)
+			added = append(added, key)
+			insts = append(insts, inst)
+		}
+		b.Insts = insts
+		for _, child := range dt.children[b] {
+			visit(child)
+		}
+		for _, key := range added {
+			delete(avail, key)
+		}
+	}
+	visit(f.Blocks[0])
+	ReplaceValues(f, repl)
+	return len(repl)
+}
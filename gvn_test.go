@@ -0,0 +1,65 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGVN(t *testing.T) {
+	src := `
+define i32 @f(i32 %a, i32 %b, i1 %c) {
+entry:
+	%x = add i32 %a, %b
+	%y = add i32 %b, %a
+	%z = add nsw i32 %a, %b
+	br i1 %c, label %then, label %exit
+
+then:
+	%w = mul i32 %x, %y
+	%v = mul i32 %y, %x
+	br label %exit
+
+exit:
+	%p = phi i32 [ %w, %then ], [ %z, %entry ]
+	%q = mul i32 %x, %y
+	%r = add i32 %p, %q
+	ret i32 %r
+}
+`
+	m := parseModule(t, "a.ll", src)
+	f := m.Funcs[0]
+	assert.Equal(t, 2, GVN(f))
+	entry, then, exit := f.Blocks[0], f.Blocks[1], f.Blocks[2]
+	assert.Len(t, entry.Insts, 2)
+	assert.Len(t, then.Insts, 1)
+	// %q is not dominated by %w, and must therefore be kept.
+	assert.Len(t, exit.Insts, 3)
+	x := entry.Insts[0].(*ir.InstAdd)
+	w := then.Insts[0].(*ir.InstMul)
+	assert.Equal(t, x, w.X)
+	assert.Equal(t, x, w.Y)
+}
+
+func TestInstKey(t *testing.T) {
+	src := `
+define void @f(i32 %a, i32* %p) {
+	%x = sub i32 %a, 1
+	%y = sub i32 %a, 1
+	%z = sub i32 1, %a
+	%l = load i32, i32* %p
+	ret void
+}
+`
+	m := parseModule(t, "a.ll", src)
+	insts := m.Funcs[0].Blocks[0].Insts
+	x, ok := InstKey(insts[0])
+	assert.True(t, ok)
+	y, _ := InstKey(insts[1])
+	z, _ := InstKey(insts[2])
+	assert.Equal(t, x, y)
+	assert.NotEqual(t, x, z)
+	_, ok = InstKey(insts[3])
+	assert.False(t, ok)
+}
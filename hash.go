@@ -0,0 +1,248 @@
+package irutil
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/value"
+)
+
+// InstKey returns a structural key of the given instruction. Two instructions
+// have the same key if they have the same opcode, operands, flags and types,
+// and thus compute the same value. Named operands are identified by identity,
+// while constant operands are identified by structure. The operands of
+// commutative instructions are ordered canonically.
+//
+// The boolean return value reports whether the instruction is pure (i.e. free
+// of side effects and memory accesses); only pure instructions have structural
+// keys.
+func InstKey(inst ir.Instruction) (string, bool) {
+	return instKey(inst, nil)
+}
+
+// instKey returns the structural key of the given instruction. If non-nil,
+// resolve is invoked on each operand before computing the key.
+func instKey(inst ir.Instruction, resolve func(v value.Value) value.Value) (string, bool) {
+	var (
+		// Opcode, flags and other non-operand properties of the instruction.
+		op string
+		// Operands of the instruction.
+		operands []value.Value
+		// Commutative instruction.
+		commutative bool
+	)
+	switch inst := inst.(type) {
+	// Unary instructions
+	case *ir.InstFNeg:
+		op = "fneg" + fastMathKey(inst.FastMathFlags)
+		operands = []value.Value{inst.X}
+	// Binary instructions
+	case *ir.InstAdd:
+		op = "add" + overflowKey(inst.OverflowFlags)
+		operands = []value.Value{inst.X, inst.Y}
+		commutative = true
+	case *ir.InstFAdd:
+		op = "fadd" + fastMathKey(inst.FastMathFlags)
+		operands = []value.Value{inst.X, inst.Y}
+		commutative = true
+	case *ir.InstSub:
+		op = "sub" + overflowKey(inst.OverflowFlags)
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstFSub:
+		op = "fsub" + fastMathKey(inst.FastMathFlags)
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstMul:
+		op = "mul" + overflowKey(inst.OverflowFlags)
+		operands = []value.Value{inst.X, inst.Y}
+		commutative = true
+	case *ir.InstFMul:
+		op = "fmul" + fastMathKey(inst.FastMathFlags)
+		operands = []value.Value{inst.X, inst.Y}
+		commutative = true
+	case *ir.InstUDiv:
+		op = "udiv" + exactKey(inst.Exact)
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstSDiv:
+		op = "sdiv" + exactKey(inst.Exact)
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstFDiv:
+		op = "fdiv" + fastMathKey(inst.FastMathFlags)
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstURem:
+		op = "urem"
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstSRem:
+		op = "srem"
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstFRem:
+		op = "frem" + fastMathKey(inst.FastMathFlags)
+		operands = []value.Value{inst.X, inst.Y}
+	// Bitwise instructions
+	case *ir.InstShl:
+		op = "shl" + overflowKey(inst.OverflowFlags)
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstLShr:
+		op = "lshr" + exactKey(inst.Exact)
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstAShr:
+		op = "ashr" + exactKey(inst.Exact)
+		operands = []value.Value{inst.X, inst.Y}
+	case *ir.InstAnd:
+		op = "and"
+		operands = []value.Value{inst.X, inst.Y}
+		commutative = true
+	case *ir.InstOr:
+		op = "or"
+		operands = []value.Value{inst.X, inst.Y}
+		commutative = true
+	case *ir.InstXor:
+		op = "xor"
+		operands = []value.Value{inst.X, inst.Y}
+		commutative = true
+	// Vector instructions
+	case *ir.InstExtractElement:
+		op = "extractelement"
+		operands = []value.Value{inst.X, inst.Index}
+	case *ir.InstInsertElement:
+		op = "insertelement"
+		operands = []value.Value{inst.X, inst.Elem, inst.Index}
+	case *ir.InstShuffleVector:
+		op = "shufflevector"
+		operands = []value.Value{inst.X, inst.Y, inst.Mask}
+	// Aggregate instructions
+	case *ir.InstExtractValue:
+		op = fmt.Sprintf("extractvalue %v", inst.Indices)
+		operands = []value.Value{inst.X}
+	case *ir.InstInsertValue:
+		op = fmt.Sprintf("insertvalue %v", inst.Indices)
+		operands = []value.Value{inst.X, inst.Elem}
+	// Memory instructions
+	case *ir.InstGetElementPtr:
+		op = "getelementptr " + inst.ElemType.String()
+		if inst.InBounds {
+			op = "getelementptr inbounds " + inst.ElemType.String()
+		}
+		operands = append([]value.Value{inst.Src}, inst.Indices...)
+	// Conversion instructions
+	case *ir.InstTrunc:
+		op = "trunc"
+		operands = []value.Value{inst.From}
+	case *ir.InstZExt:
+		op = "zext"
+		operands = []value.Value{inst.From}
+	case *ir.InstSExt:
+		op = "sext"
+		operands = []value.Value{inst.From}
+	case *ir.InstFPTrunc:
+		op = "fptrunc"
+		operands = []value.Value{inst.From}
+	case *ir.InstFPExt:
+		op = "fpext"
+		operands = []value.Value{inst.From}
+	case *ir.InstFPToUI:
+		op = "fptoui"
+		operands = []value.Value{inst.From}
+	case *ir.InstFPToSI:
+		op = "fptosi"
+		operands = []value.Value{inst.From}
+	case *ir.InstUIToFP:
+		op = "uitofp"
+		operands = []value.Value{inst.From}
+	case *ir.InstSIToFP:
+		op = "sitofp"
+		operands = []value.Value{inst.From}
+	case *ir.InstPtrToInt:
+		op = "ptrtoint"
+		operands = []value.Value{inst.From}
+	case *ir.InstIntToPtr:
+		op = "inttoptr"
+		operands = []value.Value{inst.From}
+	case *ir.InstBitCast:
+		op = "bitcast"
+		operands = []value.Value{inst.From}
+	case *ir.InstAddrSpaceCast:
+		op = "addrspacecast"
+		operands = []value.Value{inst.From}
+	// Other instructions
+	case *ir.InstICmp:
+		op = "icmp " + inst.Pred.String()
+		operands = []value.Value{inst.X, inst.Y}
+		commutative = inst.Pred == enum.IPredEQ || inst.Pred == enum.IPredNE
+	case *ir.InstFCmp:
+		op = "fcmp " + inst.Pred.String() + fastMathKey(inst.FastMathFlags)
+		operands = []value.Value{inst.X, inst.Y}
+		commutative = inst.Pred == enum.FPredOEQ || inst.Pred == enum.FPredONE || inst.Pred == enum.FPredUEQ || inst.Pred == enum.FPredUNE || inst.Pred == enum.FPredORD || inst.Pred == enum.FPredUNO
+	case *ir.InstSelect:
+		op = "select" + fastMathKey(inst.FastMathFlags)
+		operands = []value.Value{inst.Cond, inst.ValueTrue, inst.ValueFalse}
+	default:
+		// instruction with side effects or memory accesses.
+		return "", false
+	}
+	keys := make([]string, len(operands))
+	for i, operand := range operands {
+		if resolve != nil {
+			operand = resolve(operand)
+		}
+		keys[i] = operandKey(operand)
+	}
+	if commutative {
+		sort.Strings(keys)
+	}
+	typ := inst.(value.Value).Type()
+	return fmt.Sprintf("%s %s (%s)", op, typ, strings.Join(keys, ", ")), true
+}
+
+// operandKey returns the structural key of the given operand.
+func operandKey(v value.Value) string {
+	switch v := v.(type) {
+	case *ir.Global, *ir.Func, *ir.Alias, *ir.IFunc:
+		// global values are identified by identity.
+		return fmt.Sprintf("%p", v)
+	case constant.Constant:
+		// constants are identified by structure.
+		return v.String()
+	default:
+		// named values are identified by identity.
+		return fmt.Sprintf("%p", v)
+	}
+}
+
+// overflowKey returns the structural key of the given overflow flags.
+func overflowKey(flags []enum.OverflowFlag) string {
+	var ss []string
+	for _, flag := range flags {
+		ss = append(ss, flag.String())
+	}
+	return flagsKey(ss)
+}
+
+// fastMathKey returns the structural key of the given fast-math flags.
+func fastMathKey(flags []enum.FastMathFlag) string {
+	var ss []string
+	for _, flag := range flags {
+		ss = append(ss, flag.String())
+	}
+	return flagsKey(ss)
+}
+
+// exactKey returns the structural key of the exact flag.
+func exactKey(exact bool) string {
+	if exact {
+		return " exact"
+	}
+	return ""
+}
+
+// flagsKey returns the structural key of the given flags, in canonical order.
+func flagsKey(flags []string) string {
+	if len(flags) == 0 {
+		return ""
+	}
+	sort.Strings(flags)
+	return " " + strings.Join(flags, " ")
+}
@@ -0,0 +1,313 @@
+package irutil
+
+import (
+	"math/big"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// SimplifyInsts simplifies the instructions of the given function definition
+// by applying algebraic identities (e.g. x+0 = x, x*1 = x, x&x = x, x^x = 0,
+// shifts by 0, select with constant condition, redundant casts, and icmp of
+// identical operands) and strength reductions (e.g. multiplication by a power
+// of two is replaced by a left shift). Uses of simplified instructions are
+// replaced in place, and the number of simplified instructions is returned.
+func SimplifyInsts(f *ir.Func) int {
+	n := 0
+	for {
+		existing := make(map[ir.Instruction]bool)
+		for _, b := range f.Blocks {
+			for _, inst := range b.Insts {
+				existing[inst] = true
+			}
+		}
+		repl := make(map[value.Value]value.Value)
+		// resolve follows chains of simplified instructions, as an instruction
+		// may be simplified to an instruction simplified later on (e.g. in a
+		// basic block dominated by a basic block later in the block list).
+		resolve := func(v value.Value) value.Value {
+			// Guard against cycles in unreachable code.
+			for i := 0; i <= len(repl); i++ {
+				w, ok := repl[v]
+				if !ok {
+					break
+				}
+				v = w
+			}
+			return v
+		}
+		for _, b := range f.Blocks {
+			insts := b.Insts[:0]
+			for _, inst := range b.Insts {
+				v, ok := simplifyInst(inst, resolve)
+				if !ok {
+					insts = append(insts, inst)
+					continue
+				}
+				repl[inst.(value.Value)] = v
+				if newInst, ok := v.(ir.Instruction); ok && !existing[newInst] {
+					// instruction replaced by a new instruction.
+					insts = append(insts, newInst)
+				}
+			}
+			b.Insts = insts
+		}
+		if len(repl) == 0 {
+			break
+		}
+		n += len(repl)
+		for v := range repl {
+			repl[v] = resolve(v)
+		}
+		ReplaceValues(f, repl)
+	}
+	return n
+}
+
+// simplifyInst returns a simplified value (or new instruction) equivalent to
+// the given instruction. The boolean return value reports whether the
+// instruction was simplified. Resolve is invoked on each operand to account
+// for instructions simplified earlier.
+func simplifyInst(inst ir.Instruction, resolve func(v value.Value) value.Value) (value.Value, bool) {
+	switch inst := inst.(type) {
+	// Binary instructions
+	case *ir.InstAdd:
+		x, y := commuteConst(resolve(inst.X), resolve(inst.Y))
+		if isZeroValue(y) {
+			return x, true
+		}
+	case *ir.InstSub:
+		x, y := resolve(inst.X), resolve(inst.Y)
+		switch {
+		case isZeroValue(y):
+			return x, true
+		case x == y:
+			return NewZero(inst.Type()), true
+		}
+	case *ir.InstMul:
+		x, y := commuteConst(resolve(inst.X), resolve(inst.Y))
+		switch {
+		case isZeroValue(y):
+			return y, true
+		case isOneValue(y):
+			return x, true
+		}
+		if c, ok := y.(*constant.Int); ok {
+			if k, ok := log2(c); ok {
+				shl := ir.NewShl(x, constant.NewInt(c.Typ, int64(k)))
+				for _, flag := range inst.OverflowFlags {
+					// nsw is not preserved, as shl nsw has different semantics for
+					// shifts by bit width - 1.
+					if flag == enum.OverflowFlagNUW {
+						shl.OverflowFlags = append(shl.OverflowFlags, flag)
+					}
+				}
+				shl.LocalIdent = inst.LocalIdent
+				return shl, true
+			}
+		}
+	case *ir.InstUDiv:
+		x, y := resolve(inst.X), resolve(inst.Y)
+		if isOneValue(y) {
+			return x, true
+		}
+	case *ir.InstSDiv:
+		x, y := resolve(inst.X), resolve(inst.Y)
+		if isOneValue(y) {
+			return x, true
+		}
+	// Bitwise instructions
+	case *ir.InstShl:
+		x, y := resolve(inst.X), resolve(inst.Y)
+		if isZeroValue(y) {
+			return x, true
+		}
+	case *ir.InstLShr:
+		x, y := resolve(inst.X), resolve(inst.Y)
+		if isZeroValue(y) {
+			return x, true
+		}
+	case *ir.InstAShr:
+		x, y := resolve(inst.X), resolve(inst.Y)
+		if isZeroValue(y) {
+			return x, true
+		}
+	case *ir.InstAnd:
+		x, y := commuteConst(resolve(inst.X), resolve(inst.Y))
+		switch {
+		case x == y:
+			return x, true
+		case isZeroValue(y):
+			return y, true
+		case isAllOnesValue(y):
+			return x, true
+		}
+	case *ir.InstOr:
+		x, y := commuteConst(resolve(inst.X), resolve(inst.Y))
+		switch {
+		case x == y:
+			return x, true
+		case isZeroValue(y):
+			return x, true
+		case isAllOnesValue(y):
+			return y, true
+		}
+	case *ir.InstXor:
+		x, y := commuteConst(resolve(inst.X), resolve(inst.Y))
+		switch {
+		case x == y:
+			return NewZero(inst.Type()), true
+		case isZeroValue(y):
+			return x, true
+		}
+	// Conversion instructions
+	case *ir.InstTrunc:
+		// trunc (zext x) and trunc (sext x) to the type of x.
+		from := resolve(inst.From)
+		switch from := from.(type) {
+		case *ir.InstZExt:
+			if x := resolve(from.From); x.Type().Equal(inst.To) {
+				return x, true
+			}
+		case *ir.InstSExt:
+			if x := resolve(from.From); x.Type().Equal(inst.To) {
+				return x, true
+			}
+		}
+	case *ir.InstBitCast:
+		from := resolve(inst.From)
+		if from.Type().Equal(inst.To) {
+			return from, true
+		}
+		if from, ok := from.(*ir.InstBitCast); ok {
+			if x := resolve(from.From); x.Type().Equal(inst.To) {
+				return x, true
+			}
+		}
+	case *ir.InstIntToPtr:
+		// inttoptr (ptrtoint x) to the type of x.
+		if from, ok := resolve(inst.From).(*ir.InstPtrToInt); ok {
+			if x := resolve(from.From); x.Type().Equal(inst.To) {
+				return x, true
+			}
+		}
+	case *ir.InstAddrSpaceCast:
+		from := resolve(inst.From)
+		if from.Type().Equal(inst.To) {
+			return from, true
+		}
+	// Other instructions
+	case *ir.InstICmp:
+		x, y := resolve(inst.X), resolve(inst.Y)
+		if x != y || !types.Equal(inst.Type(), types.I1) {
+			break
+		}
+		switch inst.Pred {
+		case enum.IPredEQ, enum.IPredUGE, enum.IPredULE, enum.IPredSGE, enum.IPredSLE:
+			return constant.True, true
+		default:
+			return constant.False, true
+		}
+	case *ir.InstSelect:
+		cond, x, y := resolve(inst.Cond), resolve(inst.ValueTrue), resolve(inst.ValueFalse)
+		if x == y {
+			return x, true
+		}
+		if c, ok := cond.(*constant.Int); ok {
+			if c.X.Sign() != 0 {
+				return x, true
+			}
+			return y, true
+		}
+	}
+	return nil, false
+}
+
+// commuteConst returns the operands of a commutative instruction, with the
+// constant operand (if any) as the second operand.
+func commuteConst(x, y value.Value) (value.Value, value.Value) {
+	if _, ok := x.(constant.Constant); ok {
+		if _, ok := y.(constant.Constant); !ok {
+			return y, x
+		}
+	}
+	return x, y
+}
+
+// isZeroValue reports whether v is an integer constant (or vector of integer
+// constants) with all bits cleared.
+func isZeroValue(v value.Value) bool {
+	return isSplatInt(v, func(x *big.Int, bitSize uint64) bool {
+		return x.Sign() == 0
+	})
+}
+
+// isOneValue reports whether v is an integer constant (or vector of integer
+// constants) with the value one.
+func isOneValue(v value.Value) bool {
+	return isSplatInt(v, func(x *big.Int, bitSize uint64) bool {
+		if bitSize == 1 {
+			// i1 1 and i1 -1 are equivalent.
+			return x.Sign() != 0
+		}
+		return x.IsInt64() && x.Int64() == 1
+	})
+}
+
+// isAllOnesValue reports whether v is an integer constant (or vector of integer
+// constants) with all bits set.
+func isAllOnesValue(v value.Value) bool {
+	return isSplatInt(v, func(x *big.Int, bitSize uint64) bool {
+		if x.Sign() < 0 {
+			return x.IsInt64() && x.Int64() == -1
+		}
+		max := new(big.Int).Lsh(big.NewInt(1), uint(bitSize))
+		max.Sub(max, big.NewInt(1))
+		return x.Cmp(max) == 0
+	})
+}
+
+// isSplatInt reports whether v is an integer constant, or a vector of integer
+// constants, for which pred holds for all elements. Integer zero
+// initializers are treated as integer constants with the value zero.
+func isSplatInt(v value.Value, pred func(x *big.Int, bitSize uint64) bool) bool {
+	switch v := v.(type) {
+	case *constant.Int:
+		return pred(v.X, v.Typ.BitSize)
+	case *constant.ZeroInitializer:
+		t, ok := v.Typ.(*types.IntType)
+		if vt, isVector := v.Typ.(*types.VectorType); isVector {
+			t, ok = vt.ElemType.(*types.IntType)
+		}
+		return ok && pred(new(big.Int), t.BitSize)
+	case *constant.Vector:
+		if len(v.Elems) == 0 {
+			return false
+		}
+		for _, elem := range v.Elems {
+			if !isSplatInt(elem, pred) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// log2 returns the base 2 logarithm of the given integer constant, if the
+// constant is a positive power of two.
+func log2(c *constant.Int) (int, bool) {
+	if c.X.Sign() <= 0 {
+		return 0, false
+	}
+	k := c.X.BitLen() - 1
+	if c.X.TrailingZeroBits() != uint(k) || uint64(k) >= c.Typ.BitSize || k == 0 {
+		return 0, false
+	}
+	return k, true
+}
@@ -0,0 +1,70 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimplifyInsts(t *testing.T) {
+	src := `
+define i32 @f(i32 %a, i32 %b, i32* %p) {
+	%1 = add i32 %a, 0
+	%2 = mul i32 1, %1
+	%3 = and i32 %2, %2
+	%4 = xor i32 %b, %b
+	%5 = or i32 %3, %4
+	%6 = shl i32 %5, 0
+	%7 = icmp eq i32 %6, %6
+	%8 = select i1 %7, i32 %6, i32 %b
+	%9 = mul nuw i32 %8, 8
+	%10 = bitcast i32* %p to i32*
+	%11 = ptrtoint i32* %10 to i64
+	%12 = inttoptr i64 %11 to i32*
+	store i32 %9, i32* %12
+	ret i32 %9
+}
+`
+	m := parseModule(t, "a.ll", src)
+	f := m.Funcs[0]
+	assert.Equal(t, 11, SimplifyInsts(f))
+	want := `define i32 @f(i32 %a, i32 %b, i32* %p) {
+0:
+	%1 = shl nuw i32 %a, 3
+	%2 = ptrtoint i32* %p to i64
+	store i32 %1, i32* %p
+	ret i32 %1
+}`
+	ResetNames(f)
+	assert.Equal(t, want, f.LLString())
+}
+
+func TestSimplifyInstsBlockOrder(t *testing.T) {
+	// The block list is not in dominance order; %exit is dominated by %later.
+	src := `
+define i32 @f(i32 %a) {
+entry:
+	br label %later
+exit:
+	%c = add i32 %b, 0
+	ret i32 %c
+later:
+	%b = add i32 %a, 0
+	br label %exit
+}
+`
+	m := parseModule(t, "a.ll", src)
+	f := m.Funcs[0]
+	assert.Equal(t, 2, SimplifyInsts(f))
+	want := `define i32 @f(i32 %a) {
+entry:
+	br label %later
+
+exit:
+	ret i32 %a
+
+later:
+	br label %exit
+}`
+	assert.Equal(t, want, f.LLString())
+}
@@ -40,5 +40,225 @@ func (l DefaultLayout) SizeOf(typ types.Type) int {
 			panic(fmt.Errorf("support for size of on floating-point type of kind %v not yet implemented", typ.Kind))
 		}
 	}
-	panic(fmt.Errorf("support for size of on type %T not yet implemented", typ))
+	// Use the default data layout of LLVM for derived types.
+	return NewDataLayout("", "").SizeOf(typ)
+}
+
+// Ensure that DataLayout implements the Layout interface.
+var _ Layout = (*DataLayout)(nil)
+
+// SizeOf returns the size of the given type in number of bits, as specified by
+// the data layout. SizeOf panics if the type is unsized (e.g. a function type
+// or an opaque struct type).
+func (dl *DataLayout) SizeOf(typ types.Type) int {
+	size, err := dl.TypeSizeInBits(typ)
+	if err != nil {
+		panic(err)
+	}
+	return int(size)
+}
+
+// TypeSizeInBits returns the size in bits of the given type, as specified by
+// the data layout. The size of an x86_fp80 is 80 bits, the size of a vector is
+// the sum of the sizes of its elements, and the size of an aggregate includes
+// any alignment padding. An error is returned if the type is unsized.
+func (dl *DataLayout) TypeSizeInBits(typ types.Type) (uint64, error) {
+	switch typ := typ.(type) {
+	case *types.IntType:
+		return typ.BitSize, nil
+	case *types.FloatType:
+		return uint64(DefaultLayout{}.SizeOf(typ)), nil
+	case *types.MMXType:
+		return 64, nil
+	case *types.PointerType:
+		return dl.pointerSizeAlignment(typ.AddrSpace).Size, nil
+	case *types.VectorType:
+		elemSize, err := dl.TypeSizeInBits(typ.ElemType)
+		if err != nil {
+			return 0, err
+		}
+		return typ.Len * elemSize, nil
+	case *types.ArrayType:
+		elemSize, err := dl.TypeAllocSize(typ.ElemType)
+		if err != nil {
+			return 0, err
+		}
+		return 8 * typ.Len * elemSize, nil
+	case *types.StructType:
+		_, size, _, err := dl.structFieldOffsets(typ)
+		if err != nil {
+			return 0, err
+		}
+		return 8 * size, nil
+	default:
+		return 0, fmt.Errorf("unable to compute size of unsized type %v", typ)
+	}
+}
+
+// TypeStoreSize returns the maximum number of bytes which may be overwritten by
+// storing a value of the given type; i.e. the size in bits rounded up to a
+// whole number of bytes (e.g. 10 bytes for x86_fp80).
+func (dl *DataLayout) TypeStoreSize(typ types.Type) (uint64, error) {
+	size, err := dl.TypeSizeInBits(typ)
+	if err != nil {
+		return 0, err
+	}
+	return (size + 7) / 8, nil
+}
+
+// TypeAllocSize returns the offset in bytes between successive values of the
+// given type in memory (e.g. array elements), including alignment padding; i.e.
+// the store size rounded up to a multiple of the ABI alignment (e.g. 16 bytes
+// for x86_fp80 on x86-64).
+func (dl *DataLayout) TypeAllocSize(typ types.Type) (uint64, error) {
+	size, err := dl.TypeStoreSize(typ)
+	if err != nil {
+		return 0, err
+	}
+	align, err := dl.ABIAlignment(typ)
+	if err != nil {
+		return 0, err
+	}
+	return alignTo(size, align), nil
+}
+
+// ABIAlignment returns the minimum ABI alignment in bytes of the given type.
+func (dl *DataLayout) ABIAlignment(typ types.Type) (uint64, error) {
+	return dl.alignment(typ, true)
+}
+
+// PrefAlignment returns the preferred alignment in bytes of the given type,
+// which is at least the ABI alignment of the type.
+func (dl *DataLayout) PrefAlignment(typ types.Type) (uint64, error) {
+	return dl.alignment(typ, false)
+}
+
+// alignment returns the ABI alignment (if abi is set) or the preferred
+// alignment in bytes of the given type.
+func (dl *DataLayout) alignment(typ types.Type, abi bool) (uint64, error) {
+	pick := func(abiAlign, prefAlign uint64) uint64 {
+		if abi || prefAlign < abiAlign {
+			return abiAlign / 8
+		}
+		return prefAlign / 8
+	}
+	switch typ := typ.(type) {
+	case *types.IntType:
+		if a := dl.intSizeAlignment(typ.BitSize); a != nil {
+			return pick(a.ABIAlignment, a.PreferredAlignment), nil
+		}
+	case *types.FloatType:
+		size := uint64(DefaultLayout{}.SizeOf(typ))
+		if a, ok := dl.FloatingPointSizeAlignment[size]; ok {
+			return pick(a.ABIAlignment, a.PreferredAlignment), nil
+		}
+	case *types.PointerType:
+		p := dl.pointerSizeAlignment(typ.AddrSpace)
+		return pick(p.ABIAlignment, p.PreferredAlignment), nil
+	case *types.VectorType, *types.MMXType:
+		size, err := dl.TypeSizeInBits(typ)
+		if err != nil {
+			return 0, err
+		}
+		if a, ok := dl.VectorSizeAlignment[size]; ok {
+			return pick(a.ABIAlignment, a.PreferredAlignment), nil
+		}
+	case *types.ArrayType:
+		return dl.alignment(typ.ElemType, abi)
+	case *types.StructType:
+		if typ.Packed && abi {
+			// packed structs always have an ABI alignment of one.
+			return 1, nil
+		}
+		_, _, align, err := dl.structFieldOffsets(typ)
+		if err != nil {
+			return 0, err
+		}
+		if dl.AggregateAlignment != nil {
+			if aggAlign := pick(dl.AggregateAlignment.ABIAlignment, dl.AggregateAlignment.PreferredAlignment); aggAlign > align {
+				align = aggAlign
+			}
+		}
+		return align, nil
+	}
+	// Fall back to the natural alignment of the type; i.e. the store size
+	// rounded up to the nearest power of two.
+	size, err := dl.TypeStoreSize(typ)
+	if err != nil {
+		return 0, err
+	}
+	align := uint64(1)
+	for align < size {
+		align <<= 1
+	}
+	return align, nil
+}
+
+// structFieldOffsets returns the offset in bytes of each field of the given
+// struct type, and the size and alignment in bytes of the struct type.
+func (dl *DataLayout) structFieldOffsets(typ *types.StructType) (offsets []uint64, size, align uint64, err error) {
+	if typ.Opaque {
+		return nil, 0, 0, fmt.Errorf("unable to compute size of opaque struct type %v", typ)
+	}
+	align = 1
+	for _, field := range typ.Fields {
+		fieldAlign := uint64(1)
+		if !typ.Packed {
+			if fieldAlign, err = dl.ABIAlignment(field); err != nil {
+				return nil, 0, 0, err
+			}
+		}
+		if fieldAlign > align {
+			align = fieldAlign
+		}
+		size = alignTo(size, fieldAlign)
+		offsets = append(offsets, size)
+		fieldSize, err := dl.TypeAllocSize(field)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		size += fieldSize
+	}
+	// Add tail padding so that the struct may be placed in an array.
+	return offsets, alignTo(size, align), align, nil
+}
+
+// intSizeAlignment returns the alignment of integers of the given size in bits;
+// i.e. the alignment of the smallest integer type at least as large as the
+// integer type, or the largest integer type if none. A nil value is returned if
+// the data layout specifies no integer alignments.
+func (dl *DataLayout) intSizeAlignment(bitSize uint64) *IntegerSizeAlignment {
+	var best *IntegerSizeAlignment
+	for size, a := range dl.IntegerSizeAlignment {
+		switch {
+		case best == nil:
+			best = a
+		case size >= bitSize && (best.Size < bitSize || size < best.Size):
+			best = a
+		case size < bitSize && best.Size < bitSize && size > best.Size:
+			best = a
+		}
+	}
+	return best
+}
+
+// pointerSizeAlignment returns the size and alignment of pointers in the given
+// address space, falling back to address space 0, and 64-bit pointers if not
+// specified.
+func (dl *DataLayout) pointerSizeAlignment(addrSpace types.AddrSpace) *PointerSizeAlignment {
+	if p, ok := dl.PointerSizeAlignment[uint64(addrSpace)]; ok {
+		return p
+	}
+	if p, ok := dl.PointerSizeAlignment[0]; ok {
+		return p
+	}
+	return NewPointerSizeAlignment(uint64(addrSpace), 64, 64, 64, 64)
+}
+
+// alignTo returns x rounded up to a multiple of align.
+func alignTo(x, align uint64) uint64 {
+	if align == 0 {
+		return x
+	}
+	return (x + align - 1) / align * align
 }
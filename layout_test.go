@@ -0,0 +1,89 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataLayoutSizes(t *testing.T) {
+	x86_64, err := NewDataLayoutFromString("e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:128-n8:16:32:64-S128", "linux", "x86-64")
+	require.NoError(t, err)
+	i386, err := NewDataLayoutFromString("e-m:e-p:32:32-p270:32:32-p271:32:32-p272:64:64-f64:32:64-f80:32-n8:16:32-S128", "linux", "")
+	require.NoError(t, err)
+	fp80 := &types.FloatType{Kind: types.FloatKindX86_FP80}
+	st := types.NewStruct(types.I8, types.I32)
+	packed := types.NewStruct(types.I8, types.I32)
+	packed.Packed = true
+	ptr270 := types.NewPointer(types.I8)
+	ptr270.AddrSpace = 270
+	testCases := []struct {
+		name                string
+		dl                  *DataLayout
+		typ                 types.Type
+		bits, store, alloc  uint64
+		abiAlign, prefAlign uint64
+	}{
+		{"I1", x86_64, types.I1, 1, 1, 1, 1, 1},
+		{"I64", x86_64, types.I64, 64, 8, 8, 8, 8},
+		{"I128", x86_64, types.I128, 128, 16, 16, 8, 8},
+		{"X86_FP80", x86_64, fp80, 80, 10, 16, 16, 16},
+		{"Pointer", x86_64, types.I8Ptr, 64, 8, 8, 8, 8},
+		{"PointerAddrSpace", x86_64, ptr270, 32, 4, 4, 4, 4},
+		{"Vector", x86_64, types.NewVector(4, types.Float), 128, 16, 16, 16, 16},
+		{"VectorNatural", x86_64, types.NewVector(3, types.I32), 96, 12, 16, 16, 16},
+		{"Array", x86_64, types.NewArray(3, types.I16), 48, 6, 6, 2, 2},
+		{"ArrayX86_FP80", x86_64, types.NewArray(2, fp80), 256, 32, 32, 16, 16},
+		{"Struct", x86_64, st, 64, 8, 8, 4, 8},
+		{"StructPacked", x86_64, packed, 40, 5, 5, 1, 8},
+		{"StructTailPadding", x86_64, types.NewStruct(fp80, types.I8), 256, 32, 32, 16, 16},
+		{"I386Double", i386, types.Double, 64, 8, 8, 4, 8},
+		{"I386I64", i386, types.I64, 64, 8, 8, 4, 8},
+		{"I386X86_FP80", i386, fp80, 80, 10, 12, 4, 4},
+		{"I386Pointer", i386, types.I8Ptr, 32, 4, 4, 4, 4},
+		{"I386Struct", i386, types.NewStruct(types.I8, types.Double), 96, 12, 12, 4, 8},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dl := testCase.dl
+			bits, err := dl.TypeSizeInBits(testCase.typ)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.bits, bits, "size in bits")
+			assert.Equal(t, int(testCase.bits), dl.SizeOf(testCase.typ), "SizeOf")
+			store, err := dl.TypeStoreSize(testCase.typ)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.store, store, "store size")
+			alloc, err := dl.TypeAllocSize(testCase.typ)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.alloc, alloc, "alloc size")
+			abiAlign, err := dl.ABIAlignment(testCase.typ)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.abiAlign, abiAlign, "ABI alignment")
+			prefAlign, err := dl.PrefAlignment(testCase.typ)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.prefAlign, prefAlign, "preferred alignment")
+		})
+	}
+}
+
+func TestDataLayoutUnsized(t *testing.T) {
+	dl := NewDataLayout("", "")
+	for _, typ := range []types.Type{types.NewStruct(), types.Label, types.Void, types.NewFunc(types.Void)} {
+		if st, ok := typ.(*types.StructType); ok {
+			st.Opaque = true
+		}
+		_, err := dl.TypeAllocSize(typ)
+		assert.Error(t, err, "type %v", typ)
+	}
+	assert.Panics(t, func() { dl.SizeOf(types.Label) })
+}
+
+func TestDefaultLayout(t *testing.T) {
+	var l Layout = DefaultLayout{}
+	assert.Equal(t, 80, l.SizeOf(&types.FloatType{Kind: types.FloatKindX86_FP80}))
+	assert.Equal(t, 64, l.SizeOf(types.I8Ptr))
+	assert.Equal(t, 256, l.SizeOf(types.NewArray(4, types.I64)))
+	assert.Equal(t, 64, l.SizeOf(types.NewStruct(types.I8, types.I32)))
+}
@@ -0,0 +1,379 @@
+package irutil
+
+import (
+	"math/big"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/value"
+)
+
+// LICM performs loop-invariant code motion on the given function definition.
+// Loop-invariant instructions which are free of side effects and safe to
+// speculatively execute are hoisted to the preheader of the loop, and a loop
+// preheader is created when missing.
+//
+// If sinkStores is set, a store to a loop-invariant address is sunk into the
+// exit block of the loop when safe; i.e. when the store is the only memory
+// access of the loop, it is executed on every iteration of the loop, and the
+// loop has a single (dedicated) exit block.
+//
+// The number of hoisted and sunk instructions is returned.
+func LICM(f *ir.Func, sinkStores bool) int {
+	if len(f.Blocks) == 0 {
+		return 0
+	}
+	n := 0
+	// Loops are processed inner to outer. The loops of the function are
+	// recomputed after each transformation, as the creation of preheaders
+	// changes the control flow graph.
+	done := make(map[*ir.Block]bool)
+	changed := false
+	for {
+		dt := newDomTree(f)
+		var l *loop
+		for _, cand := range findLoops(dt) {
+			if !done[cand.header] {
+				l = cand
+				break
+			}
+		}
+		if l == nil {
+			break
+		}
+		done[l.header] = true
+		pre, created := ensurePreheader(f, dt, l)
+		if pre == nil {
+			continue
+		}
+		if created {
+			changed = true
+			// Recompute dominator tree to include the preheader.
+			dt = newDomTree(f)
+		}
+		n += hoistInvariants(dt, l, pre)
+		if sinkStores {
+			n += sinkInvariantStore(dt, l)
+		}
+	}
+	if changed {
+		// Assign new IDs to unnamed local variables.
+		ResetNames(f)
+	}
+	return n
+}
+
+// ensurePreheader returns the preheader of the loop, creating one if missing.
+// The boolean return value reports whether the preheader was created. A nil
+// preheader is returned if the loop header has predecessors outside the loop
+// with terminators that cannot be retargeted.
+func ensurePreheader(f *ir.Func, dt *domTree, l *loop) (*ir.Block, bool) {
+	preds := l.outsidePreds(dt)
+	if len(preds) == 0 {
+		// loop header is the entry basic block.
+		return nil, false
+	}
+	if len(preds) == 1 && len(blockSuccs(preds[0])) == 1 {
+		return preds[0], false
+	}
+	for _, pred := range preds {
+		switch pred.Term.(type) {
+		case *ir.TermBr, *ir.TermCondBr, *ir.TermSwitch:
+			// retargetable.
+		default:
+			return nil, false
+		}
+	}
+	pre := ir.NewBlock("")
+	if !l.header.IsUnnamed() {
+		pre.SetName(l.header.Name() + ".preheader")
+	}
+	pre.Parent = f
+	pre.Term = ir.NewBr(l.header)
+	isOutside := make(map[value.Value]bool)
+	for _, pred := range preds {
+		isOutside[pred] = true
+		retarget(pred.Term, l.header, pre)
+	}
+	// Move the incoming values from outside the loop of phi instructions in the
+	// loop header to the preheader.
+	for _, inst := range l.header.Insts {
+		phi, ok := inst.(*ir.InstPhi)
+		if !ok {
+			continue
+		}
+		var incs, outside []*ir.Incoming
+		for _, inc := range phi.Incs {
+			if isOutside[inc.Pred] {
+				outside = append(outside, inc)
+			} else {
+				incs = append(incs, inc)
+			}
+		}
+		switch len(outside) {
+		case 0:
+			// nothing to do.
+		case 1:
+			outside[0].Pred = pre
+			incs = append(incs, outside[0])
+		default:
+			prePhi := ir.NewPhi(outside...)
+			pre.Insts = append(pre.Insts, prePhi)
+			incs = append(incs, ir.NewIncoming(prePhi, pre))
+		}
+		phi.Incs = incs
+	}
+	// Insert preheader before the loop header.
+	var blocks []*ir.Block
+	for _, b := range f.Blocks {
+		if b == l.header {
+			blocks = append(blocks, pre)
+		}
+		blocks = append(blocks, b)
+	}
+	f.Blocks = blocks
+	return pre, true
+}
+
+// retarget replaces the branch target old with new in the given terminator.
+func retarget(term ir.Terminator, old, new *ir.Block) {
+	switch term := term.(type) {
+	case *ir.TermBr:
+		if term.Target == old {
+			term.Target = new
+		}
+		// reset cached successors.
+		term.Successors = nil
+	case *ir.TermCondBr:
+		if term.TargetTrue == old {
+			term.TargetTrue = new
+		}
+		if term.TargetFalse == old {
+			term.TargetFalse = new
+		}
+		term.Successors = nil
+	case *ir.TermSwitch:
+		if term.TargetDefault == old {
+			term.TargetDefault = new
+		}
+		for _, c := range term.Cases {
+			if c.Target == old {
+				c.Target = new
+			}
+		}
+		term.Successors = nil
+	}
+}
+
+// hoistInvariants hoists the loop-invariant instructions of the loop to the
+// given preheader, and returns the number of hoisted instructions.
+func hoistInvariants(dt *domTree, l *loop, pre *ir.Block) int {
+	// Values defined within the loop.
+	defs := make(map[value.Value]bool)
+	for b := range l.blocks {
+		for _, inst := range b.Insts {
+			if v, ok := inst.(value.Value); ok {
+				defs[v] = true
+			}
+		}
+	}
+	n := 0
+	for changed := true; changed; {
+		changed = false
+		for _, b := range dt.order {
+			if !l.blocks[b] {
+				continue
+			}
+			insts := b.Insts[:0]
+			for _, inst := range b.Insts {
+				if !isSpeculatable(inst) || !isInvariant(inst, defs) {
+					insts = append(insts, inst)
+					continue
+				}
+				pre.Insts = append(pre.Insts, inst)
+				delete(defs, inst.(value.Value))
+				changed = true
+				n++
+			}
+			b.Insts = insts
+		}
+	}
+	return n
+}
+
+// sinkInvariantStore sinks a store to a loop-invariant address into the exit
+// block of the loop when safe, and returns the number of sunk instructions.
+func sinkInvariantStore(dt *domTree, l *loop) int {
+	exits, exiting := l.exitBlocks(dt)
+	if len(exits) != 1 {
+		return 0
+	}
+	exit := exits[0]
+	// The exit block must be dedicated to the loop.
+	for _, pred := range dt.preds[exit] {
+		if !l.blocks[pred] {
+			return 0
+		}
+	}
+	// Locate the only memory access of the loop, which must be a store.
+	defs := make(map[value.Value]bool)
+	var store *ir.InstStore
+	var storeBlock *ir.Block
+	for b := range l.blocks {
+		switch b.Term.(type) {
+		case *ir.TermBr, *ir.TermCondBr, *ir.TermSwitch:
+			// no side effects.
+		default:
+			return 0
+		}
+		for _, inst := range b.Insts {
+			if v, ok := inst.(value.Value); ok {
+				defs[v] = true
+			}
+			if _, ok := inst.(*ir.InstPhi); ok {
+				continue
+			}
+			if _, ok := InstKey(inst); ok {
+				continue
+			}
+			s, ok := inst.(*ir.InstStore)
+			if !ok || store != nil || s.Atomic || s.Volatile {
+				return 0
+			}
+			store, storeBlock = s, b
+		}
+	}
+	if store == nil || defs[store.Dst] {
+		return 0
+	}
+	// The store must be executed before the loop is exited, and the stored
+	// value must be available in the exit block.
+	for _, b := range exiting {
+		if !dt.dominates(storeBlock, b) {
+			return 0
+		}
+	}
+	if defs[store.Src] {
+		srcBlock := defBlock(l, store.Src)
+		for _, b := range exiting {
+			if !dt.dominates(srcBlock, b) {
+				return 0
+			}
+		}
+		if srcBlock == storeBlock && !definedBefore(storeBlock, store.Src, store) {
+			return 0
+		}
+	}
+	var insts []ir.Instruction
+	for _, inst := range storeBlock.Insts {
+		if inst != store {
+			insts = append(insts, inst)
+		}
+	}
+	storeBlock.Insts = insts
+	// Insert store after the phi instructions of the exit block.
+	i := 0
+	for ; i < len(exit.Insts); i++ {
+		if _, ok := exit.Insts[i].(*ir.InstPhi); !ok {
+			break
+		}
+	}
+	exit.Insts = append(exit.Insts[:i], append([]ir.Instruction{store}, exit.Insts[i:]...)...)
+	return 1
+}
+
+// defBlock returns the basic block of the loop defining the given value.
+func defBlock(l *loop, v value.Value) *ir.Block {
+	for b := range l.blocks {
+		for _, inst := range b.Insts {
+			if def, ok := inst.(value.Value); ok && def == v {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// definedBefore reports whether the value v is defined before the instruction
+// inst in the given basic block.
+func definedBefore(b *ir.Block, v value.Value, inst ir.Instruction) bool {
+	for _, i := range b.Insts {
+		if i == inst {
+			return false
+		}
+		if def, ok := i.(value.Value); ok && def == v {
+			return true
+		}
+	}
+	return false
+}
+
+// isInvariant reports whether the operands of the instruction are invariant;
+// i.e. not defined by the given values defined within the loop.
+func isInvariant(inst ir.Instruction, defs map[value.Value]bool) bool {
+	for _, operand := range instOperands(inst) {
+		if defs[operand] {
+			return false
+		}
+	}
+	return true
+}
+
+// isSpeculatable reports whether the instruction is free of side effects and
+// safe to speculatively execute.
+func isSpeculatable(inst ir.Instruction) bool {
+	if _, ok := InstKey(inst); !ok {
+		return false
+	}
+	switch inst := inst.(type) {
+	case *ir.InstUDiv:
+		return isNonZeroInt(inst.Y)
+	case *ir.InstURem:
+		return isNonZeroInt(inst.Y)
+	case *ir.InstSDiv:
+		return isNonZeroInt(inst.Y) && !isAllOnesInt(inst.Y)
+	case *ir.InstSRem:
+		return isNonZeroInt(inst.Y) && !isAllOnesInt(inst.Y)
+	}
+	return true
+}
+
+// isNonZeroInt reports whether v is a non-zero integer constant.
+func isNonZeroInt(v value.Value) bool {
+	c, ok := v.(*constant.Int)
+	return ok && c.X.Sign() != 0
+}
+
+// isAllOnesInt reports whether v is an integer constant with all bits set.
+func isAllOnesInt(v value.Value) bool {
+	c, ok := v.(*constant.Int)
+	if !ok {
+		return false
+	}
+	if c.X.Sign() < 0 {
+		return c.X.IsInt64() && c.X.Int64() == -1
+	}
+	max := new(big.Int).Lsh(big.NewInt(1), uint(c.Typ.BitSize))
+	max.Sub(max, big.NewInt(1))
+	return c.X.Cmp(max) == 0
+}
+
+// instOperands returns the (non-constant) operands of the given instruction.
+func instOperands(inst ir.Instruction) []value.Value {
+	var operands []value.Value
+	Walk(inst, func(n interface{}) bool {
+		if n == inst {
+			return true
+		}
+		switch n := n.(type) {
+		case constant.Constant:
+			// skip constants.
+			return false
+		case value.Value:
+			operands = append(operands, n)
+			return false
+		}
+		return true
+	})
+	return operands
+}
@@ -0,0 +1,52 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLICM(t *testing.T) {
+	src := `
+define void @f(i32 %a, i32 %b, i32 %n, i32* %p, i1 %c) {
+entry:
+	br i1 %c, label %loop, label %other
+
+other:
+	br label %loop
+
+loop:
+	%i = phi i32 [ 0, %entry ], [ 1, %other ], [ %i.next, %loop ]
+	%x = mul i32 %a, %b
+	%y = add i32 %x, 1
+	%d = sdiv i32 %a, %b
+	%z = add i32 %i, %y
+	store i32 %z, i32* %p
+	%i.next = add i32 %i, 1
+	%cond = icmp slt i32 %i.next, %n
+	br i1 %cond, label %loop, label %exit
+
+exit:
+	ret void
+}
+`
+	m := parseModule(t, "a.ll", src)
+	f := m.Funcs[0]
+	assert.Equal(t, 3, LICM(f, true))
+	assert.Len(t, f.Blocks, 5)
+	pre := f.Blocks[2]
+	assert.Equal(t, "loop.preheader", pre.Name())
+	// phi of preheader merging incoming values, followed by hoisted %x and %y.
+	assert.Len(t, pre.Insts, 3)
+	assert.IsType(t, &ir.InstPhi{}, pre.Insts[0])
+	assert.IsType(t, &ir.InstMul{}, pre.Insts[1])
+	assert.IsType(t, &ir.InstAdd{}, pre.Insts[2])
+	// %d may trap and is therefore not hoisted.
+	loop := f.Blocks[3]
+	assert.IsType(t, &ir.InstSDiv{}, loop.Insts[1])
+	exit := f.Blocks[4]
+	assert.IsType(t, &ir.InstStore{}, exit.Insts[0])
+	// output must still be valid LLVM IR.
+	_ = m.String()
+}
@@ -0,0 +1,597 @@
+package irutil
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/metadata"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// LinkModules links the source modules into the destination module, in order.
+//
+// Declarations are resolved against definitions, and conflicting definitions
+// are resolved based on their linkage (e.g. a strong definition takes
+// precedence over weak, linkonce and common definitions, the larger of two
+// common definitions is kept, and the initializers of global variables with
+// appending linkage are concatenated). Symbols with internal or private
+// linkage are renamed on conflict. Named struct types, comdats, attribute
+// groups, named metadata and metadata definitions of the source modules are
+// merged into the destination module. The data layout and target triple of
+// the source modules must match those of the destination module, if present.
+//
+// The source modules are consumed by LinkModules and should not be used after
+// linking.
+func LinkModules(dst *ir.Module, srcs ...*ir.Module) error {
+	l := newLinker(dst)
+	for _, src := range srcs {
+		if err := l.link(src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// globalValue is a global variable, function, alias or IFunc.
+type globalValue interface {
+	constant.Constant
+	Ident
+}
+
+// linker tracks the state of linking source modules into a destination
+// module.
+type linker struct {
+	// Destination module.
+	dst *ir.Module
+	// Global values of the destination module, keyed by name.
+	syms map[string]globalValue
+	// Named types of the destination module, keyed by name.
+	typeDefs map[string]types.Type
+	// Comdat definitions of the destination module, keyed by name.
+	comdats map[string]*ir.ComdatDef
+}
+
+// newLinker returns a new linker for the given destination module.
+func newLinker(dst *ir.Module) *linker {
+	l := &linker{
+		dst:      dst,
+		syms:     make(map[string]globalValue),
+		typeDefs: make(map[string]types.Type),
+		comdats:  make(map[string]*ir.ComdatDef),
+	}
+	for _, v := range moduleGlobalValues(dst) {
+		if !v.IsUnnamed() {
+			l.syms[v.Name()] = v
+		}
+	}
+	for _, t := range dst.TypeDefs {
+		l.typeDefs[t.Name()] = t
+	}
+	for _, c := range dst.ComdatDefs {
+		l.comdats[c.Name] = c
+	}
+	return l
+}
+
+// link links the source module into the destination module.
+func (l *linker) link(src *ir.Module) error {
+	if err := l.linkTarget(src); err != nil {
+		return err
+	}
+	l.linkTypeDefs(src)
+	l.linkComdats(src)
+	l.linkAttrGroupDefs(src)
+	// Names used by the source module; used to prevent renamed symbols from
+	// clashing with symbols of the source module not yet linked.
+	srcNames := make(map[string]bool)
+	for _, v := range moduleGlobalValues(src) {
+		if !v.IsUnnamed() {
+			srcNames[v.Name()] = true
+		}
+	}
+	// Resolve global values; uses of replaced global values are updated once
+	// all global values of the source module have been linked.
+	repl := make(map[value.Value]value.Value)
+	for _, s := range moduleGlobalValues(src) {
+		if s.IsUnnamed() {
+			// Unnamed global values are assigned new IDs on output.
+			s.SetName("")
+			l.add(s)
+			continue
+		}
+		name := s.Name()
+		d, ok := l.syms[name]
+		switch {
+		case !ok:
+			l.add(s)
+		case isLocalLinkage(linkageOf(s)):
+			s.SetName(l.uniqueName(name, srcNames))
+			l.add(s)
+		case isLocalLinkage(linkageOf(d)):
+			d.SetName(l.uniqueName(name, srcNames))
+			l.syms[d.Name()] = d
+			l.add(s)
+		default:
+			keepSrc, err := l.resolve(d, s, src)
+			if err != nil {
+				return err
+			}
+			if keepSrc {
+				l.remove(d)
+				l.add(s)
+				repl[d] = castGlobalValue(s, d.Type())
+			} else {
+				repl[s] = castGlobalValue(d, s.Type())
+			}
+		}
+	}
+	ReplaceValues(l.dst, repl)
+	l.linkMetadata(src)
+	l.dst.ModuleAsms = append(l.dst.ModuleAsms, src.ModuleAsms...)
+	l.dst.UseListOrders = append(l.dst.UseListOrders, src.UseListOrders...)
+	l.dst.UseListOrderBBs = append(l.dst.UseListOrderBBs, src.UseListOrderBBs...)
+	return nil
+}
+
+// linkTarget reconciles the data layout and target triple of the source
+// module with those of the destination module.
+func (l *linker) linkTarget(src *ir.Module) error {
+	switch {
+	case len(src.DataLayout) == 0:
+		// nothing to do.
+	case len(l.dst.DataLayout) == 0:
+		l.dst.DataLayout = src.DataLayout
+	case l.dst.DataLayout != src.DataLayout:
+		dstDL, err := NewDataLayoutFromString(l.dst.DataLayout, "", "")
+		if err != nil {
+			return fmt.Errorf("unable to parse data layout %q of destination module; %v", l.dst.DataLayout, err)
+		}
+		srcDL, err := NewDataLayoutFromString(src.DataLayout, "", "")
+		if err != nil {
+			return fmt.Errorf("unable to parse data layout %q of source module %q; %v", src.DataLayout, src.SourceFilename, err)
+		}
+		if !dstDL.Compatible(srcDL) {
+			var diffs []string
+			for _, d := range dstDL.Diff(srcDL) {
+				if !d.Hint {
+					diffs = append(diffs, d.String())
+				}
+			}
+			return fmt.Errorf("data layout mismatch between destination module (%q) and source module %q (%q); %s", l.dst.DataLayout, src.SourceFilename, src.DataLayout, strings.Join(diffs, ", "))
+		}
+	}
+	switch {
+	case len(src.TargetTriple) == 0:
+		// nothing to do.
+	case len(l.dst.TargetTriple) == 0:
+		l.dst.TargetTriple = src.TargetTriple
+	case l.dst.TargetTriple != src.TargetTriple:
+		return fmt.Errorf("target triple mismatch between destination module (%q) and source module %q (%q)", l.dst.TargetTriple, src.SourceFilename, src.TargetTriple)
+	}
+	return nil
+}
+
+// linkTypeDefs merges the named types of the source module into the
+// destination module. Named types with identical definitions are merged,
+// opaque struct types are resolved against struct types with a body, and
+// conflicting named types of the source module are renamed.
+func (l *linker) linkTypeDefs(src *ir.Module) {
+	// Renamed types must not collide with types of the source module not yet
+	// linked.
+	srcNames := make(map[string]bool)
+	for _, s := range src.TypeDefs {
+		srcNames[s.Name()] = true
+	}
+	for _, s := range src.TypeDefs {
+		name := s.Name()
+		d, ok := l.typeDefs[name]
+		if !ok {
+			l.addTypeDef(s)
+			continue
+		}
+		if d.LLString() == s.LLString() {
+			// Identified struct types are uniqued by name; uses of the source
+			// type are therefore equal to the destination type.
+			continue
+		}
+		if dt, ok := d.(*types.StructType); ok && dt.Opaque {
+			if st, ok := s.(*types.StructType); ok {
+				dt.Opaque = false
+				dt.Packed = st.Packed
+				dt.Fields = st.Fields
+				continue
+			}
+		}
+		if st, ok := s.(*types.StructType); ok && st.Opaque {
+			continue
+		}
+		for i := 0; ; i++ {
+			newName := fmt.Sprintf("%s.%d", name, i)
+			if _, ok := l.typeDefs[newName]; !ok && !srcNames[newName] {
+				s.SetName(newName)
+				break
+			}
+		}
+		l.addTypeDef(s)
+	}
+}
+
+// addTypeDef adds the named type to the destination module.
+func (l *linker) addTypeDef(t types.Type) {
+	l.dst.TypeDefs = append(l.dst.TypeDefs, t)
+	l.typeDefs[t.Name()] = t
+}
+
+// linkComdats merges the comdat definitions of the source module into the
+// destination module.
+func (l *linker) linkComdats(src *ir.Module) {
+	repl := make(map[*ir.ComdatDef]*ir.ComdatDef)
+	for _, c := range src.ComdatDefs {
+		if d, ok := l.comdats[c.Name]; ok {
+			repl[c] = d
+			continue
+		}
+		l.dst.ComdatDefs = append(l.dst.ComdatDefs, c)
+		l.comdats[c.Name] = c
+	}
+	if len(repl) == 0 {
+		return
+	}
+	for _, g := range src.Globals {
+		if d, ok := repl[g.Comdat]; ok {
+			g.Comdat = d
+		}
+	}
+	for _, f := range src.Funcs {
+		if d, ok := repl[f.Comdat]; ok {
+			f.Comdat = d
+		}
+	}
+}
+
+// linkAttrGroupDefs merges the attribute group definitions of the source
+// module into the destination module, assigning new IDs to the attribute
+// groups of the source module.
+func (l *linker) linkAttrGroupDefs(src *ir.Module) {
+	nextID := int64(0)
+	for _, a := range l.dst.AttrGroupDefs {
+		if a.ID >= nextID {
+			nextID = a.ID + 1
+		}
+	}
+	for _, a := range src.AttrGroupDefs {
+		a.ID = nextID
+		nextID++
+		l.dst.AttrGroupDefs = append(l.dst.AttrGroupDefs, a)
+	}
+}
+
+// linkMetadata merges the named metadata and metadata definitions of the
+// source module into the destination module. The operands of named metadata
+// present in both modules are concatenated.
+func (l *linker) linkMetadata(src *ir.Module) {
+	for _, md := range src.MetadataDefs {
+		// Metadata definitions are assigned new IDs on output.
+		md.SetID(-1)
+		l.dst.MetadataDefs = append(l.dst.MetadataDefs, md)
+	}
+	if len(src.NamedMetadataDefs) > 0 && l.dst.NamedMetadataDefs == nil {
+		l.dst.NamedMetadataDefs = make(map[string]*metadata.NamedDef)
+	}
+	for name, s := range src.NamedMetadataDefs {
+		if d, ok := l.dst.NamedMetadataDefs[name]; ok {
+			d.Nodes = append(d.Nodes, s.Nodes...)
+			continue
+		}
+		l.dst.NamedMetadataDefs[name] = s
+	}
+}
+
+// resolve resolves the conflict between the global value d of the destination
+// module and the global value s of the source module with the same name. The
+// boolean return value reports whether s takes precedence over d.
+func (l *linker) resolve(d, s globalValue, src *ir.Module) (keepSrc bool, err error) {
+	if reflect.TypeOf(d) != reflect.TypeOf(s) {
+		return false, fmt.Errorf("unable to link symbol %s of source module %q; kind mismatch (%T in destination module, %T in source module)", s.Ident(), src.SourceFilename, d, s)
+	}
+	dl, sl := linkageOf(d), linkageOf(s)
+	if dl == enum.LinkageAppending || sl == enum.LinkageAppending {
+		if dl != sl {
+			return false, fmt.Errorf("unable to link symbol %s of source module %q; appending linkage mismatch (%v in destination module, %v in source module)", s.Ident(), src.SourceFilename, dl, sl)
+		}
+		if err := appendGlobals(d.(*ir.Global), s.(*ir.Global)); err != nil {
+			return false, fmt.Errorf("unable to link symbol %s of source module %q; %v", s.Ident(), src.SourceFilename, err)
+		}
+		return false, nil
+	}
+	switch {
+	case isDeclaration(s):
+		return false, nil
+	case isDeclaration(d):
+		return true, nil
+	}
+	dr, sr := linkageRank(dl), linkageRank(sl)
+	switch {
+	case dr == strongRank && sr == strongRank:
+		return false, fmt.Errorf("unable to link symbol %s of source module %q; symbol multiply defined (%v linkage in destination module, %v linkage in source module)", s.Ident(), src.SourceFilename, dl, sl)
+	case dl == enum.LinkageCommon && sl == enum.LinkageCommon:
+		// Keep the larger of two common symbols.
+		dt, st := d.(*ir.Global).ContentType, s.(*ir.Global).ContentType
+		return commonSize(st) > commonSize(dt), nil
+	}
+	return sr > dr, nil
+}
+
+// add adds the global value to the destination module.
+func (l *linker) add(v globalValue) {
+	switch v := v.(type) {
+	case *ir.Global:
+		l.dst.Globals = append(l.dst.Globals, v)
+	case *ir.Func:
+		v.Parent = l.dst
+		l.dst.Funcs = append(l.dst.Funcs, v)
+	case *ir.Alias:
+		l.dst.Aliases = append(l.dst.Aliases, v)
+	case *ir.IFunc:
+		l.dst.IFuncs = append(l.dst.IFuncs, v)
+	default:
+		panic(fmt.Errorf("support for global value %T not yet implemented", v))
+	}
+	if !v.IsUnnamed() {
+		l.syms[v.Name()] = v
+	}
+}
+
+// remove removes the global value from the destination module.
+func (l *linker) remove(v globalValue) {
+	switch v := v.(type) {
+	case *ir.Global:
+		l.dst.Globals = removeGlobal(l.dst.Globals, v)
+	case *ir.Func:
+		l.dst.Funcs = removeFunc(l.dst.Funcs, v)
+	case *ir.Alias:
+		l.dst.Aliases = removeAlias(l.dst.Aliases, v)
+	case *ir.IFunc:
+		l.dst.IFuncs = removeIFunc(l.dst.IFuncs, v)
+	default:
+		panic(fmt.Errorf("support for global value %T not yet implemented", v))
+	}
+	if !v.IsUnnamed() && l.syms[v.Name()] == v {
+		delete(l.syms, v.Name())
+	}
+}
+
+// uniqueName returns a unique symbol name based on the given name, which is
+// not used by the destination module nor by the source module.
+func (l *linker) uniqueName(name string, srcNames map[string]bool) string {
+	for i := 0; ; i++ {
+		newName := fmt.Sprintf("%s.%d", name, i)
+		if _, ok := l.syms[newName]; !ok && !srcNames[newName] {
+			return newName
+		}
+	}
+}
+
+// appendGlobals appends the initializer of the source global variable to the
+// initializer of the destination global variable, both of which have
+// appending linkage.
+func appendGlobals(d, s *ir.Global) error {
+	dt, ok := d.ContentType.(*types.ArrayType)
+	if !ok {
+		return fmt.Errorf("invalid content type of global variable with appending linkage; expected array type, got %v", d.ContentType)
+	}
+	st, ok := s.ContentType.(*types.ArrayType)
+	if !ok {
+		return fmt.Errorf("invalid content type of global variable with appending linkage; expected array type, got %v", s.ContentType)
+	}
+	if !dt.ElemType.Equal(st.ElemType) {
+		return fmt.Errorf("appending element type mismatch (%v in destination module, %v in source module)", dt.ElemType, st.ElemType)
+	}
+	var elems []constant.Constant
+	for _, g := range []*ir.Global{d, s} {
+		es, err := arrayElems(g.Init, g.ContentType.(*types.ArrayType))
+		if err != nil {
+			return err
+		}
+		elems = append(elems, es...)
+	}
+	t := types.NewArray(uint64(len(elems)), dt.ElemType)
+	d.ContentType = t
+	d.Init = constant.NewArray(t, elems...)
+	// Recompute pointer type of global variable.
+	d.Typ = nil
+	d.Type()
+	return nil
+}
+
+// arrayElems returns the elements of the given array constant.
+func arrayElems(c constant.Constant, t *types.ArrayType) ([]constant.Constant, error) {
+	switch c := c.(type) {
+	case nil:
+		return nil, nil
+	case *constant.Array:
+		return c.Elems, nil
+	case *constant.CharArray:
+		elems := make([]constant.Constant, len(c.X))
+		for i, b := range c.X {
+			elems[i] = constant.NewInt(types.I8, int64(b))
+		}
+		return elems, nil
+	case *constant.ZeroInitializer:
+		elems := make([]constant.Constant, t.Len)
+		for i := range elems {
+			elems[i] = NewZero(t.ElemType).(constant.Constant)
+		}
+		return elems, nil
+	default:
+		return nil, fmt.Errorf("support for array constant %T not yet implemented", c)
+	}
+}
+
+// castGlobalValue returns the global value v, casted to the given type if
+// needed.
+func castGlobalValue(v globalValue, t types.Type) value.Value {
+	if v.Type().Equal(t) {
+		return v
+	}
+	return constant.NewBitCast(v, t)
+}
+
+// moduleGlobalValues returns the global values of the given module.
+func moduleGlobalValues(m *ir.Module) []globalValue {
+	var vs []globalValue
+	for _, g := range m.Globals {
+		vs = append(vs, g)
+	}
+	for _, f := range m.Funcs {
+		vs = append(vs, f)
+	}
+	for _, a := range m.Aliases {
+		vs = append(vs, a)
+	}
+	for _, i := range m.IFuncs {
+		vs = append(vs, i)
+	}
+	return vs
+}
+
+// linkageOf returns the linkage of the given global value.
+func linkageOf(v globalValue) enum.Linkage {
+	switch v := v.(type) {
+	case *ir.Global:
+		return v.Linkage
+	case *ir.Func:
+		return v.Linkage
+	case *ir.Alias:
+		return v.Linkage
+	case *ir.IFunc:
+		return v.Linkage
+	default:
+		panic(fmt.Errorf("support for global value %T not yet implemented", v))
+	}
+}
+
+// setLinkage sets the linkage of the given global value.
+func setLinkage(v globalValue, linkage enum.Linkage) {
+	switch v := v.(type) {
+	case *ir.Global:
+		v.Linkage = linkage
+	case *ir.Func:
+		v.Linkage = linkage
+	case *ir.Alias:
+		v.Linkage = linkage
+	case *ir.IFunc:
+		v.Linkage = linkage
+	default:
+		panic(fmt.Errorf("support for global value %T not yet implemented", v))
+	}
+}
+
+// isDeclaration reports whether the given global value is a declaration.
+func isDeclaration(v globalValue) bool {
+	switch v := v.(type) {
+	case *ir.Global:
+		return v.Init == nil
+	case *ir.Func:
+		return len(v.Blocks) == 0
+	default:
+		// aliases and IFuncs are always definitions.
+		return false
+	}
+}
+
+// isLocalLinkage reports whether the given linkage is local to the module.
+func isLocalLinkage(linkage enum.Linkage) bool {
+	return linkage == enum.LinkageInternal || linkage == enum.LinkagePrivate
+}
+
+// strongRank is the linkage rank of strong definitions.
+const strongRank = 4
+
+// linkageRank returns the precedence of definitions with the given linkage
+// when resolving conflicting definitions; definitions of higher rank take
+// precedence.
+func linkageRank(linkage enum.Linkage) int {
+	switch linkage {
+	case enum.LinkageAvailableExternally:
+		return 0
+	case enum.LinkageLinkOnce, enum.LinkageLinkOnceODR:
+		return 1
+	case enum.LinkageWeak, enum.LinkageWeakODR:
+		return 2
+	case enum.LinkageCommon:
+		return 3
+	default:
+		return strongRank
+	}
+}
+
+// commonSize returns the approximate size in bits of the given type, as used
+// to select the larger of two common symbols.
+func commonSize(t types.Type) uint64 {
+	switch t := t.(type) {
+	case *types.IntType:
+		return t.BitSize
+	case *types.FloatType:
+		return uint64(DefaultLayout{}.SizeOf(t))
+	case *types.PointerType:
+		return 64
+	case *types.ArrayType:
+		return t.Len * commonSize(t.ElemType)
+	case *types.VectorType:
+		return t.Len * commonSize(t.ElemType)
+	case *types.StructType:
+		size := uint64(0)
+		for _, field := range t.Fields {
+			size += commonSize(field)
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// removeGlobal removes the global variable v from vs.
+func removeGlobal(vs []*ir.Global, v *ir.Global) []*ir.Global {
+	for i := range vs {
+		if vs[i] == v {
+			return append(vs[:i], vs[i+1:]...)
+		}
+	}
+	return vs
+}
+
+// removeFunc removes the function v from vs.
+func removeFunc(vs []*ir.Func, v *ir.Func) []*ir.Func {
+	for i := range vs {
+		if vs[i] == v {
+			return append(vs[:i], vs[i+1:]...)
+		}
+	}
+	return vs
+}
+
+// removeAlias removes the alias v from vs.
+func removeAlias(vs []*ir.Alias, v *ir.Alias) []*ir.Alias {
+	for i := range vs {
+		if vs[i] == v {
+			return append(vs[:i], vs[i+1:]...)
+		}
+	}
+	return vs
+}
+
+// removeIFunc removes the IFunc v from vs.
+func removeIFunc(vs []*ir.IFunc, v *ir.IFunc) []*ir.IFunc {
+	for i := range vs {
+		if vs[i] == v {
+			return append(vs[:i], vs[i+1:]...)
+		}
+	}
+	return vs
+}
@@ -0,0 +1,117 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/asm"
+	"github.com/llir/llvm/ir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkModules(t *testing.T) {
+	a := `
+@counter = internal global i32 0
+@weak = weak global i32 1
+@llvm.used = appending global [1 x i8*] [i8* bitcast (i32* @weak to i8*)]
+
+declare i32 @f(i32)
+
+define i32 @main() {
+	%x = call i32 @f(i32 1)
+	ret i32 %x
+}
+`
+	b := `
+@counter = internal global i32 2
+@weak = global i32 3
+@llvm.used = appending global [1 x i8*] [i8* bitcast (i32* @counter to i8*)]
+
+define i32 @f(i32 %x) {
+	%y = load i32, i32* @counter
+	%z = add i32 %x, %y
+	ret i32 %z
+}
+`
+	dst := parseModule(t, "a.ll", a)
+	src := parseModule(t, "b.ll", b)
+	require.NoError(t, LinkModules(dst, src))
+
+	names := make(map[string]bool)
+	for _, g := range dst.Globals {
+		names[g.Name()] = true
+	}
+	assert.True(t, names["counter"])
+	assert.True(t, names["counter.0"])
+	assert.Len(t, dst.Globals, 4)
+	assert.Len(t, dst.Funcs, 2)
+	for _, g := range dst.Globals {
+		switch g.Name() {
+		case "weak":
+			assert.Equal(t, "i32 3", g.Init.String())
+		case "llvm.used":
+			assert.Equal(t, "[2 x i8*]", g.ContentType.String())
+		}
+	}
+	main := dst.Funcs[0]
+	call := main.Blocks[0].Insts[0].(*ir.InstCall)
+	assert.Equal(t, dst.Funcs[1], call.Callee)
+	assert.NotEmpty(t, dst.Funcs[1].Blocks)
+}
+
+func TestLinkModulesMultiplyDefined(t *testing.T) {
+	dst := parseModule(t, "a.ll", "define void @f() {\n\tret void\n}\n")
+	src := parseModule(t, "b.ll", "define void @f() {\n\tret void\n}\n")
+	err := LinkModules(dst, src)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "multiply defined")
+}
+
+func parseModule(t *testing.T, path, content string) *ir.Module {
+	m, err := asm.ParseString(path, content)
+	require.NoError(t, err)
+	return m
+}
+
+func TestLinkModulesDataLayout(t *testing.T) {
+	dst := parseModule(t, "a.ll", `target datalayout = "e-m:e-i64:64-n8:16:32:64-S128"`)
+	src := parseModule(t, "b.ll", `target datalayout = "e-m:e-i64:64-n32:64"`)
+	require.NoError(t, LinkModules(dst, src))
+	assert.Equal(t, "e-m:e-i64:64-n8:16:32:64-S128", dst.DataLayout)
+
+	src = parseModule(t, "c.ll", `target datalayout = "E-m:e-i64:64"`)
+	err := LinkModules(dst, src)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `endianness (e): "little" != "big"`)
+}
+
+func TestLinkModulesTypeNames(t *testing.T) {
+	dst := parseModule(t, "a.ll", `
+%T = type { i32 }
+
+@a = global %T zeroinitializer
+`)
+	// The renamed source type %T must not collide with the source type %T.0.
+	src := parseModule(t, "b.ll", `
+%T = type { i64 }
+%T.0 = type { i8 }
+
+@b = global %T zeroinitializer
+@c = global %T.0 zeroinitializer
+`)
+	require.NoError(t, LinkModules(dst, src))
+	defs := make(map[string]string)
+	for _, typ := range dst.TypeDefs {
+		_, dup := defs[typ.Name()]
+		assert.False(t, dup, "type %q defined twice", typ.Name())
+		defs[typ.Name()] = typ.LLString()
+	}
+	assert.Equal(t, map[string]string{
+		"T":   "{ i32 }",
+		"T.1": "{ i64 }",
+		"T.0": "{ i8 }",
+	}, defs)
+	got := dst.String()
+	assert.Contains(t, got, "@b = global %T.1 zeroinitializer")
+	assert.Contains(t, got, "@c = global %T.0 zeroinitializer")
+}
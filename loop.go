@@ -0,0 +1,97 @@
+package irutil
+
+import (
+	"sort"
+
+	"github.com/llir/llvm/ir"
+)
+
+// loop is a natural loop of a function.
+type loop struct {
+	// Loop header; dominates all basic blocks of the loop.
+	header *ir.Block
+	// Basic blocks of the loop, including the loop header.
+	blocks map[*ir.Block]bool
+	// Latches of the loop; i.e. the sources of back edges to the loop header.
+	latches []*ir.Block
+}
+
+// findLoops returns the natural loops of the function with the given
+// dominator tree, ordered such that inner loops precede outer loops. Natural
+// loops sharing a loop header are merged.
+func findLoops(dt *domTree) []*loop {
+	var loops []*loop
+	for _, header := range dt.order {
+		var latches []*ir.Block
+		for _, pred := range dt.preds[header] {
+			// back edge from pred to header.
+			if dt.dominates(header, pred) {
+				latches = append(latches, pred)
+			}
+		}
+		if len(latches) == 0 {
+			continue
+		}
+		l := &loop{
+			header:  header,
+			blocks:  map[*ir.Block]bool{header: true},
+			latches: latches,
+		}
+		// Add basic blocks which reach the latches without passing through the
+		// loop header.
+		work := append([]*ir.Block(nil), latches...)
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			if l.blocks[b] || !dt.reachable(b) {
+				continue
+			}
+			l.blocks[b] = true
+			work = append(work, dt.preds[b]...)
+		}
+		loops = append(loops, l)
+	}
+	sort.SliceStable(loops, func(i, j int) bool {
+		return len(loops[i].blocks) < len(loops[j].blocks)
+	})
+	return loops
+}
+
+// outsidePreds returns the predecessors of the loop header which are outside
+// of the loop.
+func (l *loop) outsidePreds(dt *domTree) []*ir.Block {
+	var preds []*ir.Block
+	for _, pred := range dt.preds[l.header] {
+		if !l.blocks[pred] {
+			preds = append(preds, pred)
+		}
+	}
+	return preds
+}
+
+// exitBlocks returns the basic blocks outside of the loop which are successors
+// of basic blocks of the loop, and the basic blocks of the loop from which the
+// loop may be exited.
+func (l *loop) exitBlocks(dt *domTree) (exits, exiting []*ir.Block) {
+	seenExit := make(map[*ir.Block]bool)
+	for _, b := range dt.order {
+		if !l.blocks[b] {
+			continue
+		}
+		isExiting := false
+		for _, succ := range blockSuccs(b) {
+			if l.blocks[succ] {
+				continue
+			}
+			isExiting = true
+			if !seenExit[succ] {
+				seenExit[succ] = true
+				exits = append(exits, succ)
+			}
+		}
+		if isExiting {
+			exiting = append(exiting, b)
+		}
+	}
+	return exits, exiting
+}
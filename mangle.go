@@ -0,0 +1,256 @@
+package irutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+)
+
+// Symbol names are mangled as by the Mangler of LLVM: names starting with
+// "\x01" are emitted verbatim (without the "\x01"), private symbols are
+// prefixed with the private prefix of the mangling style, and global symbols
+// are prefixed with the global prefix of the mangling style. Functions with
+// Microsoft calling conventions (stdcall and fastcall on x86 Windows, and
+// vectorcall) are decorated with the number of bytes of their arguments.
+
+// PrivatePrefix returns the prefix of private (assembler-local) symbols of the
+// mangling style; ".L" for ELF and WinCOFF, "L" for MachO and WinX86COFF, "$"
+// for Mips and "L.." for XCOFF.
+func (m ManglingStyle) PrivatePrefix() string {
+	switch m {
+	case ELF, WinCOFF:
+		return ".L"
+	case MachO, WinX86COFF:
+		return "L"
+	case Mips:
+		return "$"
+	case XCOFF:
+		return "L.."
+	default:
+		return ""
+	}
+}
+
+// GlobalPrefix returns the prefix of global symbols of the mangling style; "_"
+// for MachO and WinX86COFF.
+func (m ManglingStyle) GlobalPrefix() string {
+	switch m {
+	case MachO, WinX86COFF:
+		return "_"
+	default:
+		return ""
+	}
+}
+
+// Mangle returns the object file symbol name of the given IR name, as mangled
+// by the mangling style. The private prefix is added if private is set, which
+// is the case for global values with private linkage.
+func (m ManglingStyle) Mangle(name string, private bool) string {
+	return m.mangle(name, private, m.GlobalPrefix())
+}
+
+// mangle returns the object file symbol name of the given IR name, using the
+// given global prefix.
+func (m ManglingStyle) mangle(name string, private bool, prefix string) string {
+	if strings.HasPrefix(name, "\x01") {
+		// do not mangle.
+		return name[1:]
+	}
+	if m.isWindows() && strings.HasPrefix(name, "?") {
+		// Microsoft C++ names are already mangled.
+		prefix = ""
+	}
+	if private {
+		prefix = m.PrivatePrefix() + prefix
+	}
+	return prefix + name
+}
+
+// Demangle returns the IR name of the given object file symbol name, and
+// reports whether the symbol is private; the inverse of Mangle. Symbols lacking
+// the global prefix of the mangling style are returned with a leading "\x01",
+// as they cannot have been produced by mangling. On x86 Windows, the
+// decorations of Microsoft calling conventions (e.g. "_f@8" of stdcall) are
+// removed.
+func (m ManglingStyle) Demangle(symbol string) (name string, private bool) {
+	if p := m.PrivatePrefix(); len(p) > 0 && strings.HasPrefix(symbol, p) {
+		private = true
+		symbol = symbol[len(p):]
+	}
+	if m.isWindows() && strings.HasPrefix(symbol, "?") {
+		// Microsoft C++ names are not prefixed.
+		return symbol, private
+	}
+	if m == WinX86COFF {
+		if name, ok := undecorate(symbol); ok {
+			return name, private
+		}
+	}
+	if p := m.GlobalPrefix(); len(p) > 0 {
+		if !strings.HasPrefix(symbol, p) {
+			return "\x01" + symbol, private
+		}
+		symbol = symbol[len(p):]
+	}
+	return symbol, private
+}
+
+// undecorate returns the name of the given symbol decorated with the number of
+// bytes of arguments of Microsoft calling conventions; "_f@N" (stdcall), "@f@N"
+// (fastcall) and "f@@N" (vectorcall). The boolean return value reports whether
+// the symbol was decorated.
+func undecorate(symbol string) (string, bool) {
+	i := strings.LastIndex(symbol, "@")
+	if i <= 0 {
+		return "", false
+	}
+	if _, err := strconv.ParseUint(symbol[i+1:], 10, 64); err != nil {
+		return "", false
+	}
+	name := symbol[:i]
+	switch {
+	case strings.HasSuffix(name, "@"):
+		// vectorcall
+		return name[:len(name)-1], true
+	case strings.HasPrefix(name, "@"), strings.HasPrefix(name, "_"):
+		// fastcall or stdcall
+		return name[1:], true
+	default:
+		return "", false
+	}
+}
+
+// isWindows reports whether the mangling style is used by Windows COFF.
+func (m ManglingStyle) isWindows() bool {
+	return m == WinCOFF || m == WinX86COFF
+}
+
+// SymbolName returns the object file symbol name of the given global value
+// (global variable, function, alias or IFunc), as mangled by the mangling style
+// of the data layout. Functions (and aliases of functions) with Microsoft
+// calling conventions are decorated with the number of bytes of their
+// arguments; e.g. "_f@8" for a stdcall function with two i32 parameters on x86
+// Windows.
+func (dl *DataLayout) SymbolName(v constant.Constant) (string, error) {
+	gv, ok := v.(globalValue)
+	if !ok {
+		return "", fmt.Errorf("invalid global value type %T", v)
+	}
+	name := gv.Name()
+	private := linkageOf(gv) == enum.LinkagePrivate
+	m := dl.Mangling
+	f := aliaseeFunc(gv)
+	if f == nil || strings.HasPrefix(name, "\x01") || (m.isWindows() && strings.HasPrefix(name, "?")) {
+		return m.Mangle(name, private), nil
+	}
+	var prefix, suffix string
+	switch {
+	case f.CallingConv == enum.CallingConvX86VectorCall:
+		// vectorcall functions are decorated with a double @ suffix.
+		suffix = "@"
+	case m == WinX86COFF && f.CallingConv == enum.CallingConvX86StdCall:
+		prefix = "_"
+	case m == WinX86COFF && f.CallingConv == enum.CallingConvX86FastCall:
+		prefix = "@"
+	default:
+		return m.Mangle(name, private), nil
+	}
+	sym := m.mangle(name, private, prefix) + suffix
+	// Variadic functions are not decorated with a byte count, unless the
+	// arguments are solely variadic.
+	if params := f.Params; f.Sig.Variadic && len(params) > 0 && !(len(params) == 1 && hasSRet(params[0])) {
+		return sym, nil
+	}
+	n, err := dl.argBytes(f)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s@%d", sym, n), nil
+}
+
+// argBytes returns the number of bytes of arguments passed on the stack to the
+// given function with a Microsoft calling convention. Each argument occupies a
+// multiple of the pointer size, and structs returned by pointer (sret) do not
+// count as arguments.
+func (dl *DataLayout) argBytes(f *ir.Func) (uint64, error) {
+	ptrSize := dl.pointerSizeAlignment(0).Size / 8
+	n := uint64(0)
+	for _, param := range f.Params {
+		if hasSRet(param) {
+			continue
+		}
+		size, err := dl.TypeAllocSize(paramByValueType(param))
+		if err != nil {
+			return 0, err
+		}
+		n += alignTo(size, ptrSize)
+	}
+	return n, nil
+}
+
+// paramByValueType returns the type of the value passed by the given
+// parameter; i.e. the element type of byval, inalloca and preallocated
+// parameters, and the parameter type otherwise.
+func paramByValueType(param *ir.Param) types.Type {
+	for _, attr := range param.Attrs {
+		var typ types.Type
+		switch attr := attr.(type) {
+		case ir.Byval:
+			typ = attr.Typ
+		case ir.Preallocated:
+			typ = attr.Typ
+		case enum.ParamAttr:
+			if attr != enum.ParamAttrInAlloca {
+				continue
+			}
+		default:
+			continue
+		}
+		if typ == nil {
+			if t, ok := param.Typ.(*types.PointerType); ok {
+				typ = t.ElemType
+			}
+		}
+		if typ != nil {
+			return typ
+		}
+	}
+	return param.Typ
+}
+
+// hasSRet reports whether the given parameter has the sret attribute.
+func hasSRet(param *ir.Param) bool {
+	for _, attr := range param.Attrs {
+		if _, ok := attr.(ir.SRet); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// aliaseeFunc returns the function of the given global value, resolving
+// aliases and pointer casts; or nil if the global value does not resolve to a
+// function.
+func aliaseeFunc(v constant.Constant) *ir.Func {
+	// Guard against cyclic aliases.
+	for i := 0; i < 100; i++ {
+		switch c := v.(type) {
+		case *ir.Func:
+			return c
+		case *ir.Alias:
+			v = c.Aliasee
+		case *constant.ExprBitCast:
+			v = c.From
+		case *constant.ExprAddrSpaceCast:
+			v = c.From
+		default:
+			return nil
+		}
+	}
+	return nil
+}
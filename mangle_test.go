@@ -0,0 +1,123 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMangle(t *testing.T) {
+	testCases := []struct {
+		mangling ManglingStyle
+		name     string
+		private  bool
+		expected string
+	}{
+		{ELF, "main", false, "main"},
+		{ELF, ".str", true, ".L.str"},
+		{MachO, "main", false, "_main"},
+		{MachO, ".str", true, "L_.str"},
+		{WinX86COFF, "main", false, "_main"},
+		{WinX86COFF, "?f@@YAXXZ", false, "?f@@YAXXZ"},
+		{WinX86COFF, "x", true, "L_x"},
+		{WinCOFF, "main", false, "main"},
+		{WinCOFF, "x", true, ".Lx"},
+		{Mips, "x", true, "$x"},
+		{XCOFF, "x", true, "L..x"},
+		{ManglingStyle(""), "x", true, "x"},
+		{MachO, "\x01foo", false, "foo"},
+		{MachO, "\x01foo", true, "foo"},
+	}
+	for _, testCase := range testCases {
+		symbol := testCase.mangling.Mangle(testCase.name, testCase.private)
+		assert.Equal(t, testCase.expected, symbol, "mangling %q of %q", testCase.mangling, testCase.name)
+		if testCase.name[0] == '\x01' {
+			continue
+		}
+		name, private := testCase.mangling.Demangle(symbol)
+		assert.Equal(t, testCase.name, name, "demangling %q of %q", testCase.mangling, symbol)
+		assert.Equal(t, testCase.private && len(testCase.mangling.PrivatePrefix()) > 0, private, "demangling %q of %q", testCase.mangling, symbol)
+	}
+}
+
+func TestDemangle(t *testing.T) {
+	testCases := []struct {
+		mangling ManglingStyle
+		symbol   string
+		name     string
+		private  bool
+	}{
+		{MachO, "foo", "\x01foo", false},
+		{WinX86COFF, "_f@8", "f", false},
+		{WinX86COFF, "@f@12", "f", false},
+		{WinX86COFF, "f@@16", "f", false},
+		{WinX86COFF, "_f@x", "f@x", false},
+		{WinX86COFF, "L_f@8", "f", true},
+		{ELF, "f@8", "f@8", false},
+	}
+	for _, testCase := range testCases {
+		name, private := testCase.mangling.Demangle(testCase.symbol)
+		assert.Equal(t, testCase.name, name, "demangling %q of %q", testCase.mangling, testCase.symbol)
+		assert.Equal(t, testCase.private, private, "demangling %q of %q", testCase.mangling, testCase.symbol)
+	}
+}
+
+func TestSymbolName(t *testing.T) {
+	i386, err := NewDataLayoutForTriple("i686-pc-windows-msvc")
+	require.NoError(t, err)
+	x86_64, err := NewDataLayoutForTriple("x86_64-pc-windows-msvc")
+	require.NoError(t, err)
+	elf, err := NewDataLayoutForTriple("x86_64-unknown-linux-gnu")
+	require.NoError(t, err)
+
+	m := ir.NewModule()
+	newFunc := func(name string, cc enum.CallingConv, params ...*ir.Param) *ir.Func {
+		f := m.NewFunc(name, types.Void, params...)
+		f.CallingConv = cc
+		return f
+	}
+	stdcall := newFunc("f", enum.CallingConvX86StdCall, ir.NewParam("a", types.I32), ir.NewParam("b", types.I8), ir.NewParam("c", types.Double))
+	fastcall := newFunc("g", enum.CallingConvX86FastCall, ir.NewParam("a", types.I64))
+	vectorcall := newFunc("h", enum.CallingConvX86VectorCall, ir.NewParam("a", types.I32))
+	st := types.NewStruct(types.I32, types.I32, types.I8)
+	byval := ir.NewParam("s", types.NewPointer(st))
+	byval.Attrs = append(byval.Attrs, ir.Byval{Typ: st})
+	sret := ir.NewParam("r", types.NewPointer(st))
+	sret.Attrs = append(sret.Attrs, ir.SRet{Typ: st})
+	byvalFunc := newFunc("k", enum.CallingConvX86StdCall, sret, byval)
+	variadic := newFunc("v", enum.CallingConvX86StdCall, ir.NewParam("a", types.I32))
+	variadic.Sig.Variadic = true
+	private := m.NewGlobalDef("p", constant.NewInt(types.I32, 0))
+	private.Linkage = enum.LinkagePrivate
+	alias := m.NewAlias("a", stdcall)
+	c := newFunc("c", enum.CallingConvC, ir.NewParam("a", types.I32))
+
+	testCases := []struct {
+		dl       *DataLayout
+		v        globalValue
+		expected string
+	}{
+		{i386, stdcall, "_f@16"},
+		{i386, fastcall, "@g@8"},
+		{i386, vectorcall, "h@@4"},
+		{i386, byvalFunc, "_k@12"},
+		{i386, variadic, "_v"},
+		{i386, private, "L_p"},
+		{i386, alias, "_a@16"},
+		{i386, c, "_c"},
+		{x86_64, stdcall, "f"},
+		{x86_64, vectorcall, "h@@8"},
+		{elf, private, ".Lp"},
+		{elf, stdcall, "f"},
+	}
+	for _, testCase := range testCases {
+		name, err := testCase.dl.SymbolName(testCase.v)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, name, "symbol name of %v", testCase.v.Ident())
+	}
+}
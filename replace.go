@@ -0,0 +1,46 @@
+package irutil
+
+import (
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/value"
+)
+
+// ReplaceValues replaces, in place, each use of a value within root which has
+// a corresponding entry in repl with the value it maps to. Root is traversed
+// using Walk.
+//
+// Operand slots which must hold a constant (e.g. global variable initializers
+// and constant expression operands) are only updated if the replacement value
+// is a constant.
+func ReplaceValues(root interface{}, repl map[value.Value]value.Value) {
+	if len(repl) == 0 {
+		return
+	}
+	Walk(root, func(n interface{}) bool {
+		switch n := n.(type) {
+		case *value.Value:
+			if *n == nil {
+				return true
+			}
+			if v, ok := repl[*n]; ok {
+				*n = v
+			}
+		case *constant.Constant:
+			if *n == nil {
+				return true
+			}
+			if v, ok := repl[*n]; ok {
+				if c, ok := v.(constant.Constant); ok {
+					*n = c
+				}
+			}
+		}
+		return true
+	})
+}
+
+// ReplaceValue replaces, in place, each use of the old value within root with
+// the new value. Root is traversed using Walk.
+func ReplaceValue(root interface{}, old, new value.Value) {
+	ReplaceValues(root, map[value.Value]value.Value{old: new})
+}
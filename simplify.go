@@ -1,90 +1,623 @@
 package irutil
 
 import (
+	"fmt"
 	"log"
 
+	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
 )
 
 // Simplify returns an equivalent (and potentially simplified) constant to
-// the constant expression.
+// the constant expression. Unsupported constant expressions are returned
+// unmodified.
 func Simplify(c constant.Constant) constant.Constant {
+	z, _, _ := SimplifyWithOptions(c, nil)
+	return z
+}
+
+// SimplifyWithDataLayout returns an equivalent (and potentially simplified)
+// constant to the constant expression, using the given data layout to
+// determine the endianness, pointer sizes and type layouts of the target. The
+// default data layout of LLVM (little-endian with 64-bit pointers) is used if
+// dl is nil.
+func SimplifyWithDataLayout(c constant.Constant, dl *DataLayout) constant.Constant {
+	z, _, _ := SimplifyWithOptions(c, &SimplifyOptions{DataLayout: dl})
+	return z
+}
+
+// DefaultMaxDepth is the default maximum recursion depth of constant expression
+// simplification.
+const DefaultMaxDepth = 1000
+
+// SimplifyOptions specifies options for constant expression simplification.
+type SimplifyOptions struct {
+	// Data layout of the target; or nil for the default data layout of LLVM
+	// (little-endian with 64-bit pointers).
+	DataLayout *DataLayout
+	// Policy for folding undefined values.
+	UndefPolicy UndefPolicy
+	// (optional) Unsupported is invoked for each constant expression not
+	// supported by the simplifier.
+	Unsupported func(c constant.Constant)
+	// (optional) Logger for constant expressions not supported by the
+	// simplifier.
+	Logger *log.Logger
+	// Maximum recursion depth; or 0 for DefaultMaxDepth.
+	MaxDepth int
+}
+
+// SimplifyWithOptions returns an equivalent (and potentially simplified)
+// constant to the constant expression, using the given options. Default
+// options are used if opts is nil. The boolean return value reports whether
+// the constant was simplified. An error is returned if the maximum recursion
+// depth is exceeded, in which case the original constant is returned.
+func SimplifyWithOptions(c constant.Constant, opts *SimplifyOptions) (constant.Constant, bool, error) {
+	s := newSimplifier(opts)
+	z := s.simplify(c)
+	if s.err != nil {
+		return c, false, s.err
+	}
+	return z, simplified(c, z), nil
+}
+
+// simplified reports whether z, the simplified result of the constant c,
+// differs from c. Fold functions may rebuild constant expressions with equal
+// operands, so distinct constants are compared by their string
+// representation.
+func simplified(c, z constant.Constant) bool {
+	return z != c && z.Ident() != c.Ident()
+}
+
+// simplifier simplifies constant expressions.
+type simplifier struct {
+	// Data layout of the target.
+	dl *DataLayout
+	// Policy for folding undefined values.
+	undef UndefPolicy
+	// Invoked for unsupported constant expressions; or nil.
+	unsupported func(c constant.Constant)
+	// Logger for unsupported constant expressions; or nil.
+	logger *log.Logger
+	// Maximum recursion depth.
+	maxDepth int
+	// Current recursion depth.
+	depth int
+	// First error encountered during simplification.
+	err error
+}
+
+// newSimplifier returns a new constant expression simplifier with the given
+// options, or default options if opts is nil.
+func newSimplifier(opts *SimplifyOptions) *simplifier {
+	if opts == nil {
+		opts = &SimplifyOptions{}
+	}
+	dl := opts.DataLayout
+	if dl == nil {
+		dl = NewDataLayout("", "")
+	}
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	return &simplifier{
+		dl:          dl,
+		undef:       opts.UndefPolicy,
+		unsupported: opts.Unsupported,
+		logger:      opts.Logger,
+		maxDepth:    maxDepth,
+	}
+}
+
+// simplify returns an equivalent (and potentially simplified) constant to the
+// constant expression. The constant is returned unmodified once an error has
+// been encountered.
+func (s *simplifier) simplify(c constant.Constant) constant.Constant {
+	if s.err != nil {
+		return c
+	}
+	if s.depth >= s.maxDepth {
+		s.err = fmt.Errorf("maximum recursion depth (%d) exceeded while simplifying constant expression %T", s.maxDepth, c)
+		return c
+	}
+	s.depth++
+	z := s.fold(c)
+	s.depth--
+	return z
+}
+
+// reportUnsupported reports the unsupported constant expression c.
+func (s *simplifier) reportUnsupported(c constant.Constant) {
+	if s.unsupported != nil {
+		s.unsupported(c)
+	}
+	if s.logger != nil {
+		s.logger.Printf("support for simplifying constant expression %T not yet implemented; returning original constant expression", c)
+	}
+}
+
+// fold returns an equivalent (and potentially simplified) constant to the
+// constant expression.
+func (s *simplifier) fold(c constant.Constant) constant.Constant {
 	switch c := c.(type) {
+	// Simple constants
+	case *constant.Int, *constant.Float, *constant.Null, *constant.NoneToken:
+		// already simplified.
+		return c
+	// Complex constants
+	case *constant.Struct, *constant.Array, *constant.CharArray, *constant.Vector, *constant.ZeroInitializer:
+		// elements are simplified when folded.
+		return c
+	// Other constants
+	case *constant.Undef, *constant.Poison, *constant.BlockAddress:
+		return c
+	// Global values
+	case *ir.Global, *ir.Func, *ir.Alias, *ir.IFunc:
+		return c
+	// Unary expressions
+	case *constant.ExprFNeg:
+		return s.foldUnary(c, c.X, foldFloatNeg)
+	// Binary expressions
 	case *constant.ExprAdd:
-		x, ok := Simplify(c.X).(*constant.Int)
-		y, ok2 := Simplify(c.Y).(*constant.Int)
-		if ok && ok2 {
-			z := constant.NewInt(x.Typ, 0)
-			z.X = z.X.Add(x.X, y.X)
+		if z, ok := s.tryFoldIntBinary(c, c.X, c.Y, func(x, y *constant.Int) constant.Constant {
+			return foldIntAdd(x, y, c.OverflowFlags)
+		}); ok {
 			return z
 		}
-		return c
+		return s.foldSymbolicAdd(c)
+	case *constant.ExprFAdd:
+		return s.foldFloatBinary(c, c.X, c.Y, foldFloatAdd)
 	case *constant.ExprSub:
-		x, ok := Simplify(c.X).(*constant.Int)
-		y, ok2 := Simplify(c.Y).(*constant.Int)
-		if ok && ok2 {
-			z := constant.NewInt(x.Typ, 0)
-			z.X = z.X.Sub(x.X, y.X)
+		if z, ok := s.tryFoldIntBinary(c, c.X, c.Y, func(x, y *constant.Int) constant.Constant {
+			return foldIntSub(x, y, c.OverflowFlags)
+		}); ok {
 			return z
 		}
-		return c
+		return s.foldSymbolicSub(c)
+	case *constant.ExprFSub:
+		return s.foldFloatBinary(c, c.X, c.Y, foldFloatSub)
 	case *constant.ExprMul:
-		x, ok := Simplify(c.X).(*constant.Int)
-		y, ok2 := Simplify(c.Y).(*constant.Int)
-		if ok && ok2 {
-			z := constant.NewInt(x.Typ, 0)
-			z.X = z.X.Mul(x.X, y.X)
+		return s.foldIntBinary(c, c.X, c.Y, func(x, y *constant.Int) constant.Constant {
+			return foldIntMul(x, y, c.OverflowFlags)
+		})
+	case *constant.ExprFMul:
+		return s.foldFloatBinary(c, c.X, c.Y, foldFloatMul)
+	case *constant.ExprUDiv:
+		return s.foldIntBinary(c, c.X, c.Y, func(x, y *constant.Int) constant.Constant {
+			return foldIntUDiv(x, y, c.Exact)
+		})
+	case *constant.ExprSDiv:
+		return s.foldIntBinary(c, c.X, c.Y, func(x, y *constant.Int) constant.Constant {
+			return foldIntSDiv(x, y, c.Exact)
+		})
+	case *constant.ExprFDiv:
+		return s.foldFloatBinary(c, c.X, c.Y, foldFloatDiv)
+	case *constant.ExprURem:
+		return s.foldIntBinary(c, c.X, c.Y, foldIntURem)
+	case *constant.ExprSRem:
+		return s.foldIntBinary(c, c.X, c.Y, foldIntSRem)
+	case *constant.ExprFRem:
+		return s.foldFloatBinary(c, c.X, c.Y, foldFloatRem)
+	// Bitwise expressions
+	case *constant.ExprShl:
+		return s.foldIntBinary(c, c.X, c.Y, func(x, y *constant.Int) constant.Constant {
+			return foldIntShl(x, y, c.OverflowFlags)
+		})
+	case *constant.ExprLShr:
+		return s.foldIntBinary(c, c.X, c.Y, func(x, y *constant.Int) constant.Constant {
+			return foldIntLShr(x, y, c.Exact)
+		})
+	case *constant.ExprAShr:
+		return s.foldIntBinary(c, c.X, c.Y, func(x, y *constant.Int) constant.Constant {
+			return foldIntAShr(x, y, c.Exact)
+		})
+	case *constant.ExprAnd:
+		return s.foldIntBinary(c, c.X, c.Y, foldIntAnd)
+	case *constant.ExprOr:
+		return s.foldIntBinary(c, c.X, c.Y, foldIntOr)
+	case *constant.ExprXor:
+		return s.foldIntBinary(c, c.X, c.Y, foldIntXor)
+	// Conversion expressions
+	case *constant.ExprTrunc:
+		return s.foldCast(c, c.From, c.To, intToInt(foldTrunc))
+	case *constant.ExprZExt:
+		return s.foldCast(c, c.From, c.To, intToInt(foldZExt))
+	case *constant.ExprSExt:
+		return s.foldCast(c, c.From, c.To, intToInt(foldSExt))
+	case *constant.ExprFPTrunc:
+		return s.foldCast(c, c.From, c.To, floatToFloat(foldFPCast))
+	case *constant.ExprFPExt:
+		return s.foldCast(c, c.From, c.To, floatToFloat(foldFPCast))
+	case *constant.ExprFPToUI:
+		return s.foldCast(c, c.From, c.To, floatToInt(foldFPToUI))
+	case *constant.ExprFPToSI:
+		return s.foldCast(c, c.From, c.To, floatToInt(foldFPToSI))
+	case *constant.ExprUIToFP:
+		return s.foldCast(c, c.From, c.To, intToFloat(foldUIToFP))
+	case *constant.ExprSIToFP:
+		return s.foldCast(c, c.From, c.To, intToFloat(foldSIToFP))
+	case *constant.ExprPtrToInt:
+		from := s.simplify(c.From)
+		if z, ok := s.foldUndefUnary(c, from, c.To); ok {
 			return z
 		}
+		to, ok := c.To.(*types.IntType)
+		if !ok {
+			return c
+		}
+		switch from := from.(type) {
+		case *constant.Null:
+			return constant.NewInt(to, 0)
+		case *constant.ExprIntToPtr:
+			// ptrtoint (inttoptr x), where x is truncated or zero extended to the
+			// pointer size and then to the integer type.
+			if x, ok := s.simplify(from.From).(*constant.Int); ok {
+				if fromType, ok := from.To.(*types.PointerType); ok {
+					ptrSize := s.dl.pointerSizeAlignment(fromType.AddrSpace).Size
+					return newInt(to, toUnsigned(toUnsigned(x.X, x.Typ.BitSize), ptrSize))
+				}
+			}
+		}
 		return c
-	case *constant.ExprSDiv:
-		// TODO: if we need to handle signed division differently from unsigned division.
-		x, ok := Simplify(c.X).(*constant.Int)
-		y, ok2 := Simplify(c.Y).(*constant.Int)
-		if ok && ok2 {
-			z := constant.NewInt(x.Typ, 0)
-			z.X = z.X.Div(x.X, y.X)
+	case *constant.ExprIntToPtr:
+		from := s.simplify(c.From)
+		if z, ok := s.foldUndefUnary(c, from, c.To); ok {
 			return z
 		}
+		to, ok := c.To.(*types.PointerType)
+		if !ok {
+			return c
+		}
+		switch from := from.(type) {
+		case *constant.Int:
+			if from.X.Sign() == 0 {
+				return constant.NewNull(to)
+			}
+		case *constant.ExprPtrToInt:
+			// inttoptr (ptrtoint x) to the type of x, provided that the integer
+			// type is wide enough to hold the pointer.
+			intType, ok := from.To.(*types.IntType)
+			if ok && from.From.Type().Equal(to) && intType.BitSize >= s.dl.pointerSizeAlignment(to.AddrSpace).Size {
+				return s.simplify(from.From)
+			}
+		}
 		return c
-	case *constant.ExprUDiv:
-		x, ok := Simplify(c.X).(*constant.Int)
-		y, ok2 := Simplify(c.Y).(*constant.Int)
-		if ok && ok2 {
-			z := constant.NewInt(x.Typ, 0)
-			z.X = z.X.Div(x.X, y.X)
+	case *constant.ExprBitCast:
+		from := s.simplify(c.From)
+		if from.Type().Equal(c.To) {
+			return from
+		}
+		if z, ok := s.foldUndefUnary(c, from, c.To); ok {
 			return z
 		}
-		return c
-	case *constant.ExprFAdd:
-		x, ok := Simplify(c.X).(*constant.Float)
-		y, ok2 := Simplify(c.Y).(*constant.Float)
-		if ok && ok2 {
-			z := constant.NewFloat(x.Typ, 0)
-			z.X = z.X.Add(x.X, y.X)
+		if inner, ok := from.(*constant.ExprBitCast); ok {
+			// bitcast (bitcast x) is equivalent to a single bitcast of x.
+			return s.simplify(constant.NewBitCast(inner.From, c.To))
+		}
+		if elems, ok := s.vectorElems(from); ok {
+			if t, ok := from.Type().(*types.VectorType); ok {
+				from = constant.NewVector(t, elems...)
+			}
+		}
+		if z := foldBitCast(from, c.To, s.dl.IsBigEndian); z != nil {
 			return z
 		}
 		return c
-	case *constant.ExprFSub:
-		x, ok := Simplify(c.X).(*constant.Float)
-		y, ok2 := Simplify(c.Y).(*constant.Float)
-		if ok && ok2 {
-			z := constant.NewFloat(x.Typ, 0)
-			z.X = z.X.Sub(x.X, y.X)
+	// Vector expressions
+	case *constant.ExprExtractElement:
+		return s.foldExtractElement(c)
+	case *constant.ExprInsertElement:
+		return s.foldInsertElement(c)
+	case *constant.ExprShuffleVector:
+		return s.foldShuffleVector(c)
+	// Aggregate expressions
+	case *constant.ExprExtractValue:
+		return s.foldExtractValue(c)
+	case *constant.ExprInsertValue:
+		return s.foldInsertValue(c)
+	// Memory expressions
+	case *constant.ExprGetElementPtr:
+		return s.foldGEP(c)
+	// Other expressions
+	case *constant.ExprICmp:
+		x, y := s.simplify(c.X), s.simplify(c.Y)
+		if z := s.foldElems(x, y, func(x, y constant.Constant) constant.Constant {
+			if z, ok := s.foldUndefCmp(c, x, y); ok {
+				return z
+			}
+			x, y = s.concrete(x), s.concrete(y)
+			if _, ok := x.(*constant.Null); ok {
+				if _, ok := y.(*constant.Null); ok {
+					// null pointers compare equal.
+					return foldICmp(c.Pred, constant.NewInt(types.I64, 0), constant.NewInt(types.I64, 0))
+				}
+			}
+			x1, ok := x.(*constant.Int)
+			y1, ok2 := y.(*constant.Int)
+			if ok && ok2 {
+				return foldICmp(c.Pred, x1, y1)
+			}
+			return nil
+		}); z != nil {
+			return z
+		}
+		if z := s.foldSymbolicICmp(c.Pred, x, y); z != nil {
 			return z
 		}
 		return c
-	case *constant.ExprFMul:
-		x, ok := Simplify(c.X).(*constant.Float)
-		y, ok2 := Simplify(c.Y).(*constant.Float)
-		if ok && ok2 {
-			z := constant.NewFloat(x.Typ, 0)
-			z.X = z.X.Mul(x.X, y.X)
+	case *constant.ExprFCmp:
+		if z := s.foldElems(s.simplify(c.X), s.simplify(c.Y), func(x, y constant.Constant) constant.Constant {
+			if z, ok := s.foldUndefCmp(c, x, y); ok {
+				return z
+			}
+			x, y = s.concrete(x), s.concrete(y)
+			x1, ok := x.(*constant.Float)
+			y1, ok2 := y.(*constant.Float)
+			if ok && ok2 {
+				return foldFCmp(c.Pred, x1, y1)
+			}
+			return nil
+		}); z != nil {
 			return z
 		}
 		return c
+	case *constant.ExprSelect:
+		return s.foldSelect(c)
 	default:
-		log.Printf("support for simplifying constant expression %T not yet implemented; returning original constant expression", c)
+		s.reportUnsupported(c)
+		return c
+	}
+}
+
+// foldSelect returns the constant folded result of the select expression if
+// the condition is constant, selecting element-wise for vector conditions. The
+// original constant expression is returned if the condition is not constant.
+func (s *simplifier) foldSelect(c *constant.ExprSelect) constant.Constant {
+	cond := s.concrete(s.simplify(c.Cond))
+	switch {
+	case isPoison(cond):
+		return constant.NewPoison(c.Type())
+	case isUndef(cond) && s.undef == UndefPolicyLLVM:
+		// Choose the operand which is not undefined.
+		if x := s.simplify(c.X); isUndef(x) {
+			return x
+		}
+		return s.simplify(c.Y)
+	}
+	if cond, ok := cond.(*constant.Int); ok {
+		if cond.X.Sign() != 0 {
+			return s.simplify(c.X)
+		}
+		return s.simplify(c.Y)
+	}
+	conds, ok := s.vectorElems(cond)
+	if !ok {
 		return c
 	}
+	x, y := s.simplify(c.X), s.simplify(c.Y)
+	xs, ok := s.vectorElems(x)
+	ys, ok2 := s.vectorElems(y)
+	if !ok || !ok2 || len(conds) != len(xs) || len(conds) != len(ys) || len(conds) == 0 {
+		return c
+	}
+	elems := make([]constant.Constant, len(conds))
+	for i, cond := range conds {
+		cond, ok := s.concrete(cond).(*constant.Int)
+		if !ok {
+			return c
+		}
+		if cond.X.Sign() != 0 {
+			elems[i] = xs[i]
+		} else {
+			elems[i] = ys[i]
+		}
+	}
+	typ := types.NewVector(uint64(len(elems)), elems[0].Type())
+	return constant.NewVector(typ, elems...)
+}
+
+// foldCast returns the constant folded result of the cast operation fold on
+// the simplified operand x, applied element-wise to vector operands. The
+// original constant expression c is returned if the operand is not foldable.
+func (s *simplifier) foldCast(c constant.Expression, x constant.Constant, to types.Type, fold func(x constant.Constant, to types.Type) constant.Constant) constant.Constant {
+	x = s.simplify(x)
+	elemTo := to
+	if t, ok := to.(*types.VectorType); ok {
+		elemTo = t.ElemType
+	}
+	if z := s.foldElems(x, x, func(x, _ constant.Constant) constant.Constant {
+		if z, ok := s.foldUndefUnary(c, x, elemTo); ok {
+			return z
+		}
+		return fold(s.concrete(x), elemTo)
+	}); z != nil {
+		return z
+	}
+	return c
+}
+
+// intToInt adapts the given integer to integer cast operation for use with
+// foldCast.
+func intToInt(fold func(x *constant.Int, to *types.IntType) constant.Constant) func(x constant.Constant, to types.Type) constant.Constant {
+	return func(x constant.Constant, to types.Type) constant.Constant {
+		x1, ok := x.(*constant.Int)
+		to1, ok2 := to.(*types.IntType)
+		if ok && ok2 {
+			return fold(x1, to1)
+		}
+		return nil
+	}
+}
+
+// floatToFloat adapts the given floating-point to floating-point cast
+// operation for use with foldCast.
+func floatToFloat(fold func(x *constant.Float, to *types.FloatType) constant.Constant) func(x constant.Constant, to types.Type) constant.Constant {
+	return func(x constant.Constant, to types.Type) constant.Constant {
+		x1, ok := x.(*constant.Float)
+		to1, ok2 := to.(*types.FloatType)
+		if ok && ok2 {
+			return fold(x1, to1)
+		}
+		return nil
+	}
+}
+
+// floatToInt adapts the given floating-point to integer cast operation for use
+// with foldCast.
+func floatToInt(fold func(x *constant.Float, to *types.IntType) constant.Constant) func(x constant.Constant, to types.Type) constant.Constant {
+	return func(x constant.Constant, to types.Type) constant.Constant {
+		x1, ok := x.(*constant.Float)
+		to1, ok2 := to.(*types.IntType)
+		if ok && ok2 {
+			return fold(x1, to1)
+		}
+		return nil
+	}
+}
+
+// intToFloat adapts the given integer to floating-point cast operation for use
+// with foldCast.
+func intToFloat(fold func(x *constant.Int, to *types.FloatType) constant.Constant) func(x constant.Constant, to types.Type) constant.Constant {
+	return func(x constant.Constant, to types.Type) constant.Constant {
+		x1, ok := x.(*constant.Int)
+		to1, ok2 := to.(*types.FloatType)
+		if ok && ok2 {
+			return fold(x1, to1)
+		}
+		return nil
+	}
+}
+
+// foldUnary returns the constant folded result of the unary floating-point
+// operation fold on the simplified operand x, applied element-wise to vector
+// operands. The original constant expression c is returned if the operand is
+// not foldable.
+func (s *simplifier) foldUnary(c constant.Expression, x constant.Constant, fold func(x *constant.Float) *constant.Float) constant.Constant {
+	x = s.simplify(x)
+	if z := s.foldElems(x, x, func(x, _ constant.Constant) constant.Constant {
+		if z, ok := s.foldUndefUnary(c, x, x.Type()); ok {
+			return z
+		}
+		if x, ok := s.concrete(x).(*constant.Float); ok {
+			return fold(x)
+		}
+		return nil
+	}); z != nil {
+		return z
+	}
+	return c
+}
+
+// foldIntBinary returns the constant folded result of the binary integer
+// operation fold on the simplified operands x and y, applied element-wise to
+// vector operands. The original constant expression c is returned if the
+// operands are not foldable, or if fold returns nil.
+func (s *simplifier) foldIntBinary(c constant.Expression, x, y constant.Constant, fold func(x, y *constant.Int) constant.Constant) constant.Constant {
+	if z, ok := s.tryFoldIntBinary(c, x, y, fold); ok {
+		return z
+	}
+	return c
+}
+
+// tryFoldIntBinary returns the constant folded result of the binary integer
+// operation fold on the simplified operands x and y, applied element-wise to
+// vector operands. The boolean return value reports whether the operation was
+// folded.
+func (s *simplifier) tryFoldIntBinary(c constant.Expression, x, y constant.Constant, fold func(x, y *constant.Int) constant.Constant) (constant.Constant, bool) {
+	if z := s.foldElems(s.simplify(x), s.simplify(y), func(x, y constant.Constant) constant.Constant {
+		if z, ok := s.foldUndefBinary(c, x, y); ok {
+			return z
+		}
+		x, y = s.concrete(x), s.concrete(y)
+		x1, ok := x.(*constant.Int)
+		y1, ok2 := y.(*constant.Int)
+		if ok && ok2 {
+			return fold(x1, y1)
+		}
+		return nil
+	}); z != nil {
+		return z, true
+	}
+	return nil, false
+}
+
+// foldFloatBinary returns the constant folded result of the binary
+// floating-point operation fold on the simplified operands x and y, applied
+// element-wise to vector operands. The original constant expression c is
+// returned if the operands are not foldable.
+func (s *simplifier) foldFloatBinary(c constant.Expression, x, y constant.Constant, fold func(x, y *constant.Float) *constant.Float) constant.Constant {
+	if z := s.foldElems(s.simplify(x), s.simplify(y), func(x, y constant.Constant) constant.Constant {
+		if z, ok := s.foldUndefBinary(c, x, y); ok {
+			return z
+		}
+		x, y = s.concrete(x), s.concrete(y)
+		x1, ok := x.(*constant.Float)
+		y1, ok2 := y.(*constant.Float)
+		if ok && ok2 {
+			return fold(x1, y1)
+		}
+		return nil
+	}); z != nil {
+		return z
+	}
+	return c
+}
+
+// foldElems returns the result of fold on the scalar operands x and y, or the
+// vector of results of fold on each pair of elements of the vector operands x
+// and y. A nil value is returned if any invocation of fold returns nil.
+func (s *simplifier) foldElems(x, y constant.Constant, fold func(x, y constant.Constant) constant.Constant) constant.Constant {
+	xs, ok := s.vectorElems(x)
+	ys, ok2 := s.vectorElems(y)
+	switch {
+	case ok && ok2:
+		if len(xs) != len(ys) || len(xs) == 0 {
+			return nil
+		}
+		elems := make([]constant.Constant, len(xs))
+		for i := range xs {
+			elem := fold(xs[i], ys[i])
+			if elem == nil {
+				return nil
+			}
+			elems[i] = elem
+		}
+		typ := types.NewVector(uint64(len(elems)), elems[0].Type())
+		return newVector(typ, elems)
+	case ok || ok2:
+		// mixed scalar and vector operands.
+		return nil
+	default:
+		return fold(x, y)
+	}
+}
+
+// vectorElems returns the simplified elements of the given vector constant.
+// The boolean return value reports whether c is a vector constant.
+func (s *simplifier) vectorElems(c constant.Constant) ([]constant.Constant, bool) {
+	if _, ok := c.Type().(*types.VectorType); !ok {
+		return nil, false
+	}
+	return s.aggregateElems(c)
+}
+
+// newVector returns a new vector constant of the given type with the given
+// elements. Vectors of only undefined or only poison elements are represented
+// as undefined or poison values of vector type, respectively.
+func newVector(typ *types.VectorType, elems []constant.Constant) constant.Constant {
+	allUndef, allPoison := true, true
+	for _, elem := range elems {
+		allUndef = allUndef && isUndef(elem)
+		allPoison = allPoison && isPoison(elem)
+	}
+	switch {
+	case allPoison:
+		return constant.NewPoison(typ)
+	case allUndef:
+		return constant.NewUndef(typ)
+	default:
+		return constant.NewVector(typ, elems...)
+	}
 }
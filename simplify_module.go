@@ -0,0 +1,113 @@
+package irutil
+
+import (
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/value"
+)
+
+// SimplifyModule simplifies, in place, the constant expressions of the given
+// module; i.e. global variable initializers, instruction operands, phi
+// incoming values and switch case values. The data layout of the module is
+// used for simplification. The number of folded constant expressions is
+// returned.
+func SimplifyModule(m *ir.Module) (int, error) {
+	dl, err := moduleDataLayout(m)
+	if err != nil {
+		return 0, err
+	}
+	return simplifyConstants([]interface{}{m}, &SimplifyOptions{DataLayout: dl}, false)
+}
+
+// SimplifyFunc simplifies, in place, the constant expressions of the given
+// function; i.e. instruction operands, phi incoming values and switch case
+// values. Global variable initializers and other functions referenced by the
+// function are left unchanged. The data layout of the parent module (if any)
+// is used for simplification. The number of folded constant expressions is
+// returned.
+func SimplifyFunc(f *ir.Func) (int, error) {
+	dl, err := moduleDataLayout(f.Parent)
+	if err != nil {
+		return 0, err
+	}
+	var roots []interface{}
+	for _, block := range f.Blocks {
+		for _, inst := range block.Insts {
+			roots = append(roots, inst)
+		}
+		if block.Term != nil {
+			roots = append(roots, block.Term)
+		}
+	}
+	return simplifyConstants(roots, &SimplifyOptions{DataLayout: dl}, true)
+}
+
+// simplifyConstants simplifies, in place, the constant expressions of the
+// given roots using the given options, and returns the number of folded
+// constant expressions. Roots are traversed using Walk. If local is set, the
+// traversal does not descend into global values, basic blocks or instructions
+// other than the roots; i.e. only the operands of the roots are simplified.
+func simplifyConstants(roots []interface{}, opts *SimplifyOptions, local bool) (int, error) {
+	s := newSimplifier(opts)
+	n := 0
+	// simplify simplifies the constant expression of the given operand slot,
+	// and reports whether it was folded.
+	simplify := func(c constant.Constant) (constant.Constant, bool) {
+		if _, ok := c.(constant.Expression); !ok {
+			return nil, false
+		}
+		s.depth = 0
+		z := s.simplify(c)
+		if s.err != nil || !simplified(c, z) {
+			return nil, false
+		}
+		n++
+		return z, true
+	}
+	for _, root := range roots {
+		walkConstants(root, s, simplify, local)
+	}
+	return n, s.err
+}
+
+// walkConstants replaces, in place, the constant expressions of root folded by
+// simplify. If local is set, the walk does not descend into global values,
+// basic blocks or instructions other than root.
+func walkConstants(root interface{}, s *simplifier, simplify func(c constant.Constant) (constant.Constant, bool), local bool) {
+	Walk(root, func(node interface{}) bool {
+		if s.err != nil {
+			return false
+		}
+		if local && node != root {
+			switch node.(type) {
+			case *ir.Global, *ir.Func, *ir.Alias, *ir.IFunc, *ir.Block, ir.Instruction, ir.Terminator:
+				return false
+			}
+		}
+		switch node := node.(type) {
+		case *constant.Constant:
+			if z, ok := simplify(*node); ok {
+				*node = z
+				// skip folded constant.
+				return false
+			}
+		case *value.Value:
+			if c, ok := (*node).(constant.Constant); ok {
+				if z, ok := simplify(c); ok {
+					*node = z
+					return false
+				}
+			}
+		}
+		return true
+	})
+}
+
+// moduleDataLayout returns the data layout of the given module, or nil if the
+// module is nil or has no data layout.
+func moduleDataLayout(m *ir.Module) (*DataLayout, error) {
+	if m == nil || len(m.DataLayout) == 0 {
+		return nil, nil
+	}
+	return NewDataLayoutFromString(m.DataLayout, "", "")
+}
@@ -0,0 +1,96 @@
+package irutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimplifyModule(t *testing.T) {
+	const src = `
+@x = global i64 add (i64 1, i64 2)
+@y = global [2 x i32] [i32 mul (i32 2, i32 3), i32 4]
+
+define i32 @f(i32 %a, i1 %c) {
+entry:
+	%b = add i32 %a, sub (i32 10, i32 4)
+	switch i32 %b, label %exit [
+		i32 add (i32 1, i32 1), label %then
+	]
+then:
+	br label %exit
+exit:
+	%p = phi i32 [ xor (i32 3, i32 1), %entry ], [ %b, %then ]
+	ret i32 %p
+}
+`
+	m := parseModule(t, "simplify.ll", src)
+	n, err := SimplifyModule(m)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	got := m.String()
+	for _, want := range []string{
+		"@x = global i64 3",
+		"@y = global [2 x i32] [i32 6, i32 4]",
+		"%b = add i32 %a, 6",
+		"i32 2, label %then",
+		"%p = phi i32 [ 2, %entry ], [ %b, %then ]",
+	} {
+		assert.True(t, strings.Contains(got, want), "missing %q in\n%s", want, got)
+	}
+}
+
+func TestSimplifyFunc(t *testing.T) {
+	const src = `
+target datalayout = "E-p:32:32"
+
+@g = global i32 0
+
+define i32 @f() {
+	%a = add i32 ptrtoint (i32* @g to i32), lshr (i32 bitcast (<2 x i16> <i16 1, i16 2> to i32), i32 16)
+	ret i32 %a
+}
+`
+	m := parseModule(t, "simplify.ll", src)
+	n, err := SimplifyFunc(m.Funcs[0])
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	// big-endian; element 0 occupies the most significant bits.
+	assert.Contains(t, m.Funcs[0].LLString(), "%a = add i32 ptrtoint (i32* @g to i32), 1")
+}
+
+func TestSimplifyFuncLocal(t *testing.T) {
+	const src = `
+@g = global i32 add (i32 1, i32 2)
+
+define i32 @h() {
+	%a = add i32 0, mul (i32 2, i32 3)
+	ret i32 %a
+}
+
+define i32 @f() {
+	%a = call i32 @h()
+	%b = load i32, i32* @g
+	%c = add i32 %a, %b
+	%d = add i32 %c, sub (i32 10, i32 4)
+	ret i32 %d
+}
+`
+	m := parseModule(t, "simplify.ll", src)
+	f := m.Funcs[1]
+	n, err := SimplifyFunc(f)
+	require.NoError(t, err)
+	// Only folds within @f are counted.
+	assert.Equal(t, 1, n)
+	assert.Contains(t, f.LLString(), "%d = add i32 %c, 6")
+	// Global variable initializers and other functions are left unchanged.
+	got := m.String()
+	for _, want := range []string{
+		"@g = global i32 add (i32 1, i32 2)",
+		"%a = add i32 0, mul (i32 2, i32 3)",
+	} {
+		assert.True(t, strings.Contains(got, want), "missing %q in\n%s", want, got)
+	}
+}
@@ -1,11 +1,17 @@
 package irutil
 
 import (
+	"bytes"
+	"log"
+	"math"
 	"testing"
 
+	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
 	"github.com/llir/llvm/ir/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIntAdd(t *testing.T) {
@@ -32,3 +38,416 @@ func TestIntAdd(t *testing.T) {
 		})
 	}
 }
+
+func TestIntWrap(t *testing.T) {
+	nsw := func(e *constant.ExprAdd) *constant.ExprAdd {
+		e.OverflowFlags = []enum.OverflowFlag{enum.OverflowFlagNSW}
+		return e
+	}
+	nuw := func(e *constant.ExprSub) *constant.ExprSub {
+		e.OverflowFlags = []enum.OverflowFlag{enum.OverflowFlagNUW}
+		return e
+	}
+	exact := func(e *constant.ExprUDiv) *constant.ExprUDiv {
+		e.Exact = true
+		return e
+	}
+	testCases := []struct {
+		name     string
+		expected constant.Constant
+		from     constant.Constant
+	}{
+		{"AddWrap", constant.NewInt(types.I8, -128),
+			constant.NewAdd(constant.NewInt(types.I8, 127), constant.NewInt(types.I8, 1))},
+		{"AddNSW", constant.NewPoison(types.I8),
+			nsw(constant.NewAdd(constant.NewInt(types.I8, 127), constant.NewInt(types.I8, 1)))},
+		{"SubNUW", constant.NewPoison(types.I8),
+			nuw(constant.NewSub(constant.NewInt(types.I8, 1), constant.NewInt(types.I8, 2)))},
+		{"MulWrap", constant.NewInt(types.I8, 0),
+			constant.NewMul(constant.NewInt(types.I8, 16), constant.NewInt(types.I8, 16))},
+		{"I1Add", constant.False,
+			constant.NewAdd(constant.True, constant.True)},
+		{"UDivUnsigned", constant.NewInt(types.I8, 127),
+			constant.NewUDiv(constant.NewInt(types.I8, -1), constant.NewInt(types.I8, 2))},
+		{"UDivExact", constant.NewPoison(types.I8),
+			exact(constant.NewUDiv(constant.NewInt(types.I8, 3), constant.NewInt(types.I8, 2)))},
+		{"SDivTrunc", constant.NewInt(types.I32, -1),
+			constant.NewSDiv(constant.NewInt(types.I32, -3), constant.NewInt(types.I32, 2))},
+		{"SDivOverflow", constant.NewPoison(types.I8),
+			constant.NewSDiv(constant.NewInt(types.I8, -128), constant.NewInt(types.I8, -1))},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, Simplify(testCase.from))
+		})
+	}
+	divByZero := constant.NewSDiv(constant.NewInt(types.I32, 1), constant.NewInt(types.I32, 0))
+	assert.Equal(t, divByZero, Simplify(divByZero))
+}
+
+func TestFoldBinary(t *testing.T) {
+	i8 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I8, x)
+	}
+	f64 := func(x float64) *constant.Float {
+		return constant.NewFloat(types.Double, x)
+	}
+	shlNUW := constant.NewShl(i8(64), i8(2))
+	shlNUW.OverflowFlags = []enum.OverflowFlag{enum.OverflowFlagNUW}
+	shlNSW := constant.NewShl(i8(-1), i8(7))
+	shlNSW.OverflowFlags = []enum.OverflowFlag{enum.OverflowFlagNSW}
+	lshrExact := constant.NewLShr(i8(3), i8(1))
+	lshrExact.Exact = true
+	v2i8 := types.NewVector(2, types.I8)
+	testCases := []struct {
+		name     string
+		expected string
+		from     constant.Constant
+	}{
+		{"URem", "i8 1", constant.NewURem(i8(-1), i8(2))},
+		{"SRem", "i8 -1", constant.NewSRem(i8(-7), i8(2))},
+		{"SRemOverflow", "i8 poison", constant.NewSRem(i8(-128), i8(-1))},
+		{"URemByZero", "i8 urem (i8 1, i8 0)", constant.NewURem(i8(1), i8(0))},
+		{"Shl", "i8 -128", constant.NewShl(i8(1), i8(7))},
+		{"ShlOversized", "i8 poison", constant.NewShl(i8(1), i8(8))},
+		{"ShlNUW", "i8 poison", shlNUW},
+		{"ShlNSW", "i8 -128", shlNSW},
+		{"LShr", "i8 127", constant.NewLShr(i8(-1), i8(1))},
+		{"LShrExact", "i8 poison", lshrExact},
+		{"AShr", "i8 -1", constant.NewAShr(i8(-1), i8(1))},
+		{"AShrOversized", "i8 poison", constant.NewAShr(i8(-1), i8(-1))},
+		{"And", "i8 4", constant.NewAnd(i8(12), i8(6))},
+		{"Or", "i8 -1", constant.NewOr(i8(-16), i8(15))},
+		{"Xor", "i8 -11", constant.NewXor(i8(-1), i8(10))},
+		{"FDiv", "double 0x3FD5555555555555", constant.NewFDiv(f64(1), f64(3))},
+		{"FDivByZero", "double 0xFFF0000000000000", constant.NewFDiv(f64(-1), f64(0))},
+		{"FDivZeroByZero", "double 0x7FF8000000000000", constant.NewFDiv(f64(0), f64(0))},
+		{"FRem", "double -1.0", constant.NewFRem(f64(-7), f64(3))},
+		{"FNeg", "double -0.0", constant.NewFNeg(f64(0))},
+		{"FAddFloat", "float 0x3FB99999A0000000",
+			constant.NewFAdd(constant.NewFloat(types.Float, 0.0625), constant.NewFloat(types.Float, 0.0375))},
+		{"Vector", "<2 x i8> <i8 3, i8 -128>",
+			constant.NewAdd(
+				constant.NewVector(v2i8, i8(1), i8(127)),
+				constant.NewVector(v2i8, i8(2), i8(1)))},
+		{"VectorZero", "<2 x i8> <i8 0, i8 0>",
+			constant.NewAnd(constant.NewZeroInitializer(v2i8), constant.NewVector(v2i8, i8(1), i8(2)))},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, Simplify(testCase.from).String())
+		})
+	}
+}
+
+func TestFoldCmp(t *testing.T) {
+	i8 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I8, x)
+	}
+	f64 := func(x float64) *constant.Float {
+		return constant.NewFloat(types.Double, x)
+	}
+	nan := f64(math.NaN())
+	v2i1 := types.NewVector(2, types.I1)
+	v2i8 := types.NewVector(2, types.I8)
+	testCases := []struct {
+		name     string
+		expected string
+		from     constant.Constant
+	}{
+		{"EQ", "i1 true", constant.NewICmp(enum.IPredEQ, i8(3), i8(3))},
+		{"NE", "i1 false", constant.NewICmp(enum.IPredNE, i8(3), i8(3))},
+		{"SLT", "i1 true", constant.NewICmp(enum.IPredSLT, i8(-1), i8(0))},
+		{"ULT", "i1 false", constant.NewICmp(enum.IPredULT, i8(-1), i8(0))},
+		{"UGE", "i1 true", constant.NewICmp(enum.IPredUGE, i8(-1), i8(127))},
+		{"SGT", "i1 false", constant.NewICmp(enum.IPredSGT, i8(-128), i8(127))},
+		{"NullEQ", "i1 true", constant.NewICmp(enum.IPredEQ,
+			constant.NewNull(types.I8Ptr), constant.NewNull(types.I8Ptr))},
+		{"OLT", "i1 true", constant.NewFCmp(enum.FPredOLT, f64(1), f64(2))},
+		{"OEQZero", "i1 true", constant.NewFCmp(enum.FPredOEQ, f64(0), f64(math.Copysign(0, -1)))},
+		{"OEQNaN", "i1 false", constant.NewFCmp(enum.FPredOEQ, nan, nan)},
+		{"UEQNaN", "i1 true", constant.NewFCmp(enum.FPredUEQ, nan, f64(1))},
+		{"ONENaN", "i1 false", constant.NewFCmp(enum.FPredONE, nan, f64(1))},
+		{"UNENaN", "i1 true", constant.NewFCmp(enum.FPredUNE, nan, f64(1))},
+		{"ORD", "i1 true", constant.NewFCmp(enum.FPredORD, f64(1), f64(2))},
+		{"UNO", "i1 true", constant.NewFCmp(enum.FPredUNO, f64(1), nan)},
+		{"True", "i1 true", constant.NewFCmp(enum.FPredTrue, nan, nan)},
+		{"VectorICmp", "<2 x i1> <i1 true, i1 false>",
+			constant.NewICmp(enum.IPredSLT,
+				constant.NewVector(v2i8, i8(1), i8(2)),
+				constant.NewVector(v2i8, i8(2), i8(1)))},
+		{"Select", "i8 2", constant.NewSelect(
+			constant.NewICmp(enum.IPredEQ, i8(1), i8(2)), i8(1), i8(2))},
+		{"VectorSelect", "<2 x i8> <i8 1, i8 4>", constant.NewSelect(
+			constant.NewVector(v2i1, constant.True, constant.False),
+			constant.NewVector(v2i8, i8(1), i8(2)),
+			constant.NewVector(v2i8, i8(3), i8(4)))},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, Simplify(testCase.from).String())
+		})
+	}
+}
+
+func TestFoldCast(t *testing.T) {
+	i8 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I8, x)
+	}
+	f64 := func(x float64) *constant.Float {
+		return constant.NewFloat(types.Double, x)
+	}
+	i80 := types.NewInt(80)
+	g := ir.NewGlobal("g", types.I8)
+	v2i16 := types.NewVector(2, types.I16)
+	v2 := constant.NewVector(v2i16, constant.NewInt(types.I16, 1), constant.NewInt(types.I16, 2))
+	bigEndian, err := NewDataLayoutFromString("E-p:64:64", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		expected string
+		from     constant.Constant
+		dl       *DataLayout
+	}{
+		{"Trunc", "i8 44", constant.NewTrunc(constant.NewInt(types.I32, 300), types.I8), nil},
+		{"ZExt", "i32 255", constant.NewZExt(i8(-1), types.I32), nil},
+		{"SExt", "i32 -1", constant.NewSExt(i8(-1), types.I32), nil},
+		{"SExtI1", "i8 -1", constant.NewSExt(constant.True, types.I8), nil},
+		{"FPTruncFloat", "float 0x3FB99999A0000000", constant.NewFPTrunc(f64(0.1), types.Float), nil},
+		{"FPTruncHalfOverflow", "half 0xH7C00", constant.NewFPTrunc(f64(65520), types.Half), nil},
+		{"FPTruncHalfMax", "half 0xH7BFF", constant.NewFPTrunc(f64(65519), types.Half), nil},
+		{"FPTruncHalfUnderflow", "half 0.0", constant.NewFPTrunc(f64(1e-8), types.Half), nil},
+		{"FPTruncHalfSubnormal", "half 0xH0001", constant.NewFPTrunc(f64(6e-8), types.Half), nil},
+		{"FPExtX86FP80", "x86_fp80 0xK3FFBCCCCCD0000000000",
+			constant.NewFPExt(constant.NewFPTrunc(f64(0.1), types.Float), types.X86_FP80), nil},
+		{"FPToSI", "i8 -3", constant.NewFPToSI(f64(-3.7), types.I8), nil},
+		{"FPToSIOverflow", "i8 poison", constant.NewFPToSI(f64(200), types.I8), nil},
+		{"FPToUINegative", "i8 poison", constant.NewFPToUI(f64(-1), types.I8), nil},
+		{"FPToUI", "i8 -56", constant.NewFPToUI(f64(200.5), types.I8), nil},
+		{"SIToFPRound", "double 9.007199254740992e+15",
+			constant.NewSIToFP(constant.NewInt(types.I64, 1<<53+1), types.Double), nil},
+		{"UIToFP", "float 255.0", constant.NewUIToFP(i8(-1), types.Float), nil},
+		{"BitCastFloat", "i32 1065353216", constant.NewBitCast(constant.NewFloat(types.Float, 1), types.I32), nil},
+		{"BitCastHalf", "i16 15360", constant.NewBitCast(constant.NewFloat(types.Half, 1), types.I16), nil},
+		{"BitCastToDouble", "double -2.0",
+			constant.NewBitCast(constant.NewInt(types.I64, -0x4000000000000000), types.Double), nil},
+		{"BitCastX86FP80", "x86_fp80 0xK3FFF8000000000000000",
+			constant.NewBitCast(constant.NewBitCast(constant.NewFloat(types.X86_FP80, 1), i80), types.X86_FP80), nil},
+		{"BitCastVectorLE", "i32 131073", constant.NewBitCast(v2, types.I32), nil},
+		{"BitCastVectorBE", "i32 65538", constant.NewBitCast(v2, types.I32), bigEndian},
+		{"BitCastToVector", "<2 x i16> <i16 1, i16 2>",
+			constant.NewBitCast(constant.NewInt(types.I32, 131073), v2i16), nil},
+		{"IntToPtrPtrToInt", "i8* @g",
+			constant.NewIntToPtr(constant.NewPtrToInt(g, types.I64), types.I8Ptr), nil},
+		{"IntToPtrPtrToIntNarrow", "i8* inttoptr (i32 ptrtoint (i8* @g to i32) to i8*)",
+			constant.NewIntToPtr(constant.NewPtrToInt(g, types.I32), types.I8Ptr), nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, SimplifyWithDataLayout(testCase.from, testCase.dl).String())
+		})
+	}
+}
+
+func TestFoldAggregate(t *testing.T) {
+	i32 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I32, x)
+	}
+	st := types.NewStruct(types.I32, types.NewArray(2, types.I8))
+	s := constant.NewStruct(st, i32(1), NewCString("a"))
+	v4i32 := types.NewVector(4, types.I32)
+	v := constant.NewVector(v4i32, i32(1), i32(2), i32(3), i32(4))
+	v2i32 := types.NewVector(2, types.I32)
+	testCases := []struct {
+		name     string
+		expected string
+		from     constant.Constant
+	}{
+		{"ExtractValue", "i32 1", constant.NewExtractValue(s, 0)},
+		{"ExtractValueCharArray", "i8 97", constant.NewExtractValue(s, 1, 0)},
+		{"ExtractValueZero", "i8 0", constant.NewExtractValue(constant.NewZeroInitializer(st), 1, 1)},
+		{"InsertValue", `{ i32, [2 x i8] } { i32 1, [2 x i8] c"b\00" }`,
+			constant.NewInsertValue(s, constant.NewInt(types.I8, 'b'), 1, 0)},
+		{"InsertValueZero", "{ i32, [2 x i8] } { i32 7, [2 x i8] zeroinitializer }",
+			constant.NewInsertValue(constant.NewZeroInitializer(st), i32(7), 0)},
+		{"ExtractElement", "i32 3", constant.NewExtractElement(v, i32(2))},
+		{"ExtractElementOutOfBounds", "i32 poison", constant.NewExtractElement(v, i32(4))},
+		{"InsertElement", "<4 x i32> <i32 1, i32 2, i32 9, i32 4>",
+			constant.NewInsertElement(v, i32(9), i32(2))},
+		{"ShuffleVector", "<2 x i32> <i32 4, i32 poison>",
+			constant.NewShuffleVector(v, constant.NewZeroInitializer(v4i32),
+				constant.NewVector(v2i32, i32(3), constant.NewUndef(types.I32)))},
+		{"ShuffleVectorSecond", "<2 x i32> <i32 0, i32 1>",
+			constant.NewShuffleVector(v, constant.NewZeroInitializer(v4i32),
+				constant.NewVector(v2i32, i32(4), i32(0)))},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, Simplify(testCase.from).String())
+		})
+	}
+}
+
+func TestFoldSymbolic(t *testing.T) {
+	i64 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I64, x)
+	}
+	m := ir.NewModule()
+	arr := types.NewArray(4, types.I64)
+	g := m.NewGlobalDef("g", constant.NewZeroInitializer(arr))
+	h := m.NewGlobalDef("h", constant.NewZeroInitializer(arr))
+	weak := m.NewGlobalDef("weak", constant.NewZeroInitializer(arr))
+	weak.Linkage = enum.LinkageWeak
+	ext := m.NewGlobal("ext", types.I64)
+	ext.Linkage = enum.LinkageExternWeak
+	x := constant.NewPtrToInt(g, types.I64)
+	gep := func(src constant.Constant, idx int64) constant.Constant {
+		return constant.NewGetElementPtr(arr, src, i64(0), i64(idx))
+	}
+	eq := func(x, y constant.Constant) constant.Constant {
+		return constant.NewICmp(enum.IPredEQ, x, y)
+	}
+	null := constant.NewNull(types.NewPointer(arr))
+	testCases := []struct {
+		name     string
+		expected string
+		from     constant.Constant
+	}{
+		{"SubPtrToInt", "i64 8", constant.NewSub(constant.NewPtrToInt(gep(g, 1), types.I64), x)},
+		{"SubPtrToIntNegative", "i64 -16", constant.NewSub(x, constant.NewPtrToInt(gep(g, 2), types.I64))},
+		{"SubPtrToIntTrunc", "i32 24", constant.NewSub(constant.NewPtrToInt(gep(g, 3), types.I32), constant.NewPtrToInt(g, types.I32))},
+		{"SubPtrToIntAdd", "i64 11", constant.NewSub(constant.NewAdd(constant.NewPtrToInt(gep(g, 1), types.I64), i64(3)), x)},
+		{"SubDistinct", "i64 sub (i64 ptrtoint ([4 x i64]* @h to i64), i64 ptrtoint ([4 x i64]* @g to i64))",
+			constant.NewSub(constant.NewPtrToInt(h, types.I64), x)},
+		{"AddAdd", "i64 add (i64 ptrtoint ([4 x i64]* @g to i64), i64 3)",
+			constant.NewAdd(constant.NewAdd(x, i64(1)), i64(2))},
+		{"AddAddCommuted", "i64 add (i64 ptrtoint ([4 x i64]* @g to i64), i64 3)",
+			constant.NewAdd(i64(2), constant.NewAdd(i64(1), x))},
+		{"AddAddZero", "i64 ptrtoint ([4 x i64]* @g to i64)",
+			constant.NewAdd(constant.NewAdd(x, i64(1)), i64(-1))},
+		{"AddAddAdd", "i64 add (i64 ptrtoint ([4 x i64]* @g to i64), i64 6)",
+			constant.NewAdd(constant.NewAdd(constant.NewAdd(x, i64(1)), i64(2)), i64(3))},
+		{"ICmpDistinct", "i1 false", eq(g, h)},
+		{"ICmpDistinctNE", "i1 true", constant.NewICmp(enum.IPredNE, g, h)},
+		{"ICmpSame", "i1 true", eq(gep(g, 1), gep(g, 1))},
+		{"ICmpSameOffsets", "i1 false", eq(gep(g, 1), gep(g, 2))},
+		{"ICmpWeak", "i1 icmp eq ([4 x i64]* @g, [4 x i64]* @weak)", eq(g, weak)},
+		{"ICmpOffset", "i1 icmp eq ([4 x i64]* getelementptr ([4 x i64], [4 x i64]* @g, i64 1), [4 x i64]* @h)",
+			eq(constant.NewGetElementPtr(arr, g, i64(1)), h)},
+		{"ICmpNull", "i1 false", eq(g, null)},
+		{"ICmpNullExternWeak", "i1 icmp eq (i64* @ext, i64* null)", eq(ext, constant.NewNull(types.I64Ptr))},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, Simplify(testCase.from).String())
+		})
+	}
+	// Add expressions without constant terms to combine are not rebuilt.
+	add := constant.NewAdd(constant.NewAdd(x, i64(1)), x)
+	assert.Same(t, add, Simplify(add))
+}
+
+func TestFoldUndef(t *testing.T) {
+	i8 := func(x int64) *constant.Int {
+		return constant.NewInt(types.I8, x)
+	}
+	undef := constant.NewUndef(types.I8)
+	poison := constant.NewPoison(types.I8)
+	fundef := constant.NewUndef(types.Double)
+	v2i8 := types.NewVector(2, types.I8)
+	testCases := []struct {
+		name     string
+		expected string
+		from     constant.Constant
+		policy   UndefPolicy
+	}{
+		{"AddPoison", "i8 poison", constant.NewAdd(poison, i8(1)), UndefPolicyLLVM},
+		{"AddPoisonPreserve", "i8 poison", constant.NewAdd(i8(1), poison), UndefPolicyPreserve},
+		{"AddUndef", "i8 undef", constant.NewAdd(undef, i8(1)), UndefPolicyLLVM},
+		{"AndUndef", "i8 0", constant.NewAnd(undef, i8(5)), UndefPolicyLLVM},
+		{"AndUndefUndef", "i8 undef", constant.NewAnd(undef, undef), UndefPolicyLLVM},
+		{"OrUndef", "i8 -1", constant.NewOr(i8(5), undef), UndefPolicyLLVM},
+		{"XorUndefUndef", "i8 0", constant.NewXor(undef, undef), UndefPolicyLLVM},
+		{"MulUndef", "i8 0", constant.NewMul(undef, i8(3)), UndefPolicyLLVM},
+		{"UDivByUndef", "i8 poison", constant.NewUDiv(i8(3), undef), UndefPolicyLLVM},
+		{"UDivUndef", "i8 0", constant.NewUDiv(undef, i8(3)), UndefPolicyLLVM},
+		{"ShlByUndef", "i8 poison", constant.NewShl(i8(3), undef), UndefPolicyLLVM},
+		{"FAddUndef", "double 0x7FF8000000000000", constant.NewFAdd(fundef, constant.NewFloat(types.Double, 1)), UndefPolicyLLVM},
+		{"ZExtUndef", "i32 0", constant.NewZExt(undef, types.I32), UndefPolicyLLVM},
+		{"TruncUndef", "i1 undef", constant.NewTrunc(undef, types.I1), UndefPolicyLLVM},
+		{"ICmpEQUndef", "i1 undef", constant.NewICmp(enum.IPredEQ, undef, i8(1)), UndefPolicyLLVM},
+		{"ICmpULEUndef", "i1 true", constant.NewICmp(enum.IPredULE, undef, i8(1)), UndefPolicyLLVM},
+		{"FCmpOLTUndef", "i1 false", constant.NewFCmp(enum.FPredOLT, fundef, fundef), UndefPolicyLLVM},
+		{"FCmpUNEUndef", "i1 true", constant.NewFCmp(enum.FPredUNE, fundef, fundef), UndefPolicyLLVM},
+		{"SelectUndef", "i8 2", constant.NewSelect(constant.NewUndef(types.I1), i8(1), i8(2)), UndefPolicyLLVM},
+		{"SelectPoison", "i8 poison", constant.NewSelect(constant.NewPoison(types.I1), i8(1), i8(2)), UndefPolicyLLVM},
+		{"VectorUndef", "<2 x i8> undef",
+			constant.NewAdd(constant.NewUndef(v2i8), constant.NewVector(v2i8, i8(1), i8(2))), UndefPolicyLLVM},
+		{"ZeroPolicy", "i8 1", constant.NewAdd(undef, i8(1)), UndefPolicyZero},
+		{"ZeroPolicyDiv", "i8 udiv (i8 3, i8 undef)", constant.NewUDiv(i8(3), undef), UndefPolicyZero},
+		{"PreservePolicy", "i8 and (i8 undef, i8 5)", constant.NewAnd(undef, i8(5)), UndefPolicyPreserve},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			opts := &SimplifyOptions{UndefPolicy: testCase.policy}
+			got, _, err := SimplifyWithOptions(testCase.from, opts)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, got.String())
+		})
+	}
+}
+
+func TestSimplifyWithOptions(t *testing.T) {
+	one := constant.NewInt(types.I32, 1)
+	// Folded.
+	got, folded, err := SimplifyWithOptions(constant.NewAdd(one, one), nil)
+	require.NoError(t, err)
+	assert.True(t, folded)
+	assert.Equal(t, "i32 2", got.String())
+	// Not folded.
+	div := constant.NewUDiv(one, constant.NewInt(types.I32, 0))
+	got, folded, err = SimplifyWithOptions(div, nil)
+	require.NoError(t, err)
+	assert.False(t, folded)
+	assert.Equal(t, div, got)
+	// Not folded; symbolic expressions without constant terms to combine.
+	g := ir.NewGlobal("g", types.I8)
+	x := constant.NewPtrToInt(g, types.I32)
+	add := constant.NewAdd(constant.NewAdd(x, one), x)
+	got, folded, err = SimplifyWithOptions(add, nil)
+	require.NoError(t, err)
+	assert.False(t, folded)
+	assert.Equal(t, add.String(), got.String())
+	// Unsupported.
+	cast := constant.NewAddrSpaceCast(g, types.NewPointer(types.I8))
+	var unsupported []constant.Constant
+	buf := &bytes.Buffer{}
+	opts := &SimplifyOptions{
+		Unsupported: func(c constant.Constant) {
+			unsupported = append(unsupported, c)
+		},
+		Logger: log.New(buf, "", 0),
+	}
+	got, folded, err = SimplifyWithOptions(cast, opts)
+	require.NoError(t, err)
+	assert.False(t, folded)
+	assert.Equal(t, cast, got)
+	assert.Equal(t, []constant.Constant{cast}, unsupported)
+	assert.Contains(t, buf.String(), "*constant.ExprAddrSpaceCast")
+	// Recursion depth limit.
+	var c constant.Constant = one
+	for i := 0; i < 10; i++ {
+		c = constant.NewAdd(c, one)
+	}
+	_, _, err = SimplifyWithOptions(c, &SimplifyOptions{MaxDepth: 5})
+	assert.Error(t, err)
+	got, _, err = SimplifyWithOptions(c, &SimplifyOptions{MaxDepth: 20})
+	require.NoError(t, err)
+	assert.Equal(t, "i32 11", got.String())
+}
@@ -0,0 +1,89 @@
+package irutil
+
+import (
+	"sort"
+
+	"github.com/llir/llvm/ir/types"
+)
+
+// StructLayout specifies the memory layout of a struct type, as specified by a
+// data layout. All offsets and sizes are in bytes.
+type StructLayout struct {
+	// Struct type.
+	Type *types.StructType
+	// Offset of each field from the start of the struct.
+	Offsets []uint64
+	// Allocation size of each field.
+	Sizes []uint64
+	// Size of the struct, including tail padding.
+	Size uint64
+	// ABI alignment of the struct.
+	Align uint64
+	// Padding between fields and after the last field, in order of offset.
+	Padding []Padding
+}
+
+// Padding is a range of padding bytes in a struct.
+type Padding struct {
+	// Offset of the first padding byte from the start of the struct.
+	Offset uint64
+	// Number of padding bytes.
+	Size uint64
+}
+
+// End returns the offset of the first byte after the padding range.
+func (p Padding) End() uint64 {
+	return p.Offset + p.Size
+}
+
+// StructLayout returns the memory layout of the given struct type. An error is
+// returned if the struct type is opaque or contains unsized fields.
+func (dl *DataLayout) StructLayout(typ *types.StructType) (*StructLayout, error) {
+	offsets, size, _, err := dl.structFieldOffsets(typ)
+	if err != nil {
+		return nil, err
+	}
+	align, err := dl.ABIAlignment(typ)
+	if err != nil {
+		return nil, err
+	}
+	l := &StructLayout{
+		Type:    typ,
+		Offsets: offsets,
+		Sizes:   make([]uint64, len(typ.Fields)),
+		Size:    size,
+		Align:   align,
+	}
+	end := uint64(0)
+	for i, field := range typ.Fields {
+		if l.Sizes[i], err = dl.TypeAllocSize(field); err != nil {
+			return nil, err
+		}
+		if offsets[i] > end {
+			l.Padding = append(l.Padding, Padding{Offset: end, Size: offsets[i] - end})
+		}
+		end = offsets[i] + l.Sizes[i]
+	}
+	if size > end {
+		// tail padding.
+		l.Padding = append(l.Padding, Padding{Offset: end, Size: size - end})
+	}
+	return l, nil
+}
+
+// FieldAtOffset returns the index of the field containing the byte at the given
+// offset from the start of the struct. The boolean return value is false if the
+// offset is within padding or outside of the struct. Zero-sized fields never
+// contain any bytes.
+func (l *StructLayout) FieldAtOffset(offset uint64) (int, bool) {
+	// Only the last field starting at or before offset may contain the byte,
+	// as fields do not overlap; zero-sized fields share their offset with the
+	// subsequent field.
+	i := sort.Search(len(l.Offsets), func(i int) bool {
+		return l.Offsets[i] > offset
+	}) - 1
+	if i >= 0 && offset < l.Offsets[i]+l.Sizes[i] {
+		return i, true
+	}
+	return 0, false
+}
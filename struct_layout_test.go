@@ -0,0 +1,79 @@
+package irutil
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructLayout(t *testing.T) {
+	dl, err := NewDataLayoutFromString("e-m:e-i64:64-f80:128-n8:16:32:64-S128", "linux", "x86-64")
+	require.NoError(t, err)
+	fp80 := &types.FloatType{Kind: types.FloatKindX86_FP80}
+	packed := types.NewStruct(types.I8, types.I32)
+	packed.Packed = true
+	empty := types.NewStruct()
+	testCases := []struct {
+		name    string
+		typ     *types.StructType
+		offsets []uint64
+		size    uint64
+		align   uint64
+		padding []Padding
+	}{
+		{"Empty", empty, nil, 0, 1, nil},
+		{"Padding", types.NewStruct(types.I8, types.I32, types.I8), []uint64{0, 4, 8}, 12, 4,
+			[]Padding{{Offset: 1, Size: 3}, {Offset: 9, Size: 3}}},
+		{"Packed", packed, []uint64{0, 1}, 5, 1, nil},
+		{"X86_FP80", types.NewStruct(types.I8, fp80), []uint64{0, 16}, 32, 16,
+			[]Padding{{Offset: 1, Size: 15}}},
+		{"Nested", types.NewStruct(types.I16, types.NewStruct(types.I8, types.I64)), []uint64{0, 8}, 24, 8,
+			[]Padding{{Offset: 2, Size: 6}}},
+		{"ZeroSized", types.NewStruct(types.I8, empty, types.I32), []uint64{0, 1, 4}, 8, 4,
+			[]Padding{{Offset: 1, Size: 3}}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			l, err := dl.StructLayout(testCase.typ)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.offsets, l.Offsets)
+			assert.Equal(t, testCase.size, l.Size)
+			assert.Equal(t, testCase.align, l.Align)
+			assert.Equal(t, testCase.padding, l.Padding)
+		})
+	}
+	opaque := types.NewStruct()
+	opaque.Opaque = true
+	_, err = dl.StructLayout(opaque)
+	assert.Error(t, err)
+}
+
+func TestFieldAtOffset(t *testing.T) {
+	dl := NewDataLayout("", "")
+	st := types.NewStruct(types.I8, types.NewStruct(), types.I32, types.NewArray(2, types.I16))
+	l, err := dl.StructLayout(st)
+	require.NoError(t, err)
+	testCases := []struct {
+		offset uint64
+		field  int
+		ok     bool
+	}{
+		{0, 0, true},
+		{1, 0, false},
+		{3, 0, false},
+		{4, 2, true},
+		{7, 2, true},
+		{8, 3, true},
+		{11, 3, true},
+		{12, 0, false},
+	}
+	for _, testCase := range testCases {
+		field, ok := l.FieldAtOffset(testCase.offset)
+		assert.Equal(t, testCase.ok, ok, "offset %d", testCase.offset)
+		if ok {
+			assert.Equal(t, testCase.field, field, "offset %d", testCase.offset)
+		}
+	}
+}
@@ -123,6 +123,8 @@ func resetType(inst value.Value) {
 		inst.Typ = nil
 	case *ir.InstSelect:
 		inst.Typ = nil
+	case *ir.InstFreeze:
+		inst.Typ = nil
 	case *ir.InstCall:
 		inst.Typ = nil
 	case *ir.InstVAArg:
@@ -54,6 +54,8 @@ func walk(root interface{}, visit func(n interface{}) bool, visited map[interfac
 		walk(*root, visit, visited)
 	case **ir.UseListOrderBB:
 		walk(*root, visit, visited)
+	case **ir.InlineAsm:
+		walk(*root, visit, visited)
 	// Constants
 	// Simple constants
 	case **constant.Int:
@@ -87,6 +89,9 @@ func walk(root interface{}, visit func(n interface{}) bool, visited map[interfac
 	// Undefined values
 	case **constant.Undef:
 		walk(*root, visit, visited)
+	// Poison values
+	case **constant.Poison:
+		walk(*root, visit, visited)
 	// Addresses of basic blocks
 	case **constant.BlockAddress:
 		walk(*root, visit, visited)
@@ -287,6 +292,8 @@ func walk(root interface{}, visit func(n interface{}) bool, visited map[interfac
 		walk(*root, visit, visited)
 	case **ir.InstSelect:
 		walk(*root, visit, visited)
+	case **ir.InstFreeze:
+		walk(*root, visit, visited)
 	case **ir.InstCall:
 		walk(*root, visit, visited)
 	case **ir.InstVAArg:
@@ -475,6 +482,8 @@ func walk(root interface{}, visit func(n interface{}) bool, visited map[interfac
 	case *ir.UseListOrderBB:
 		walk(&root.Func, visit, visited)
 		walk(&root.Block, visit, visited)
+	case *ir.InlineAsm:
+		// nothing to do
 	// Metadata.
 	case *metadata.NamedDef:
 		for i := range root.Nodes {
@@ -581,13 +590,16 @@ func walkConst(root constant.Constant, visit func(n interface{}) bool, visited m
 	// Undefined values
 	case *constant.Undef:
 		// nothing to do
+	// Poison values
+	case *constant.Poison:
+		// nothing to do
 	// Addresses of basic blocks
 	case *constant.BlockAddress:
 		walk(&root.Func, visit, visited)
 		walk(&root.Block, visit, visited)
 	// Constant expressions
 	case constant.Expression:
-		walk(root, visit, visited)
+		walkConstExpr(root, visit, visited)
 	default:
 		panic(fmt.Errorf("support for LLVM IR AST node type %T not yet implemented", root))
 	}
@@ -872,6 +884,8 @@ func walkInst(root ir.Instruction, visit func(n interface{}) bool, visited map[i
 		walk(&root.Cond, visit, visited)
 		walk(&root.ValueTrue, visit, visited)
 		walk(&root.ValueFalse, visit, visited)
+	case *ir.InstFreeze:
+		walk(&root.X, visit, visited)
 	case *ir.InstCall:
 		walk(&root.Callee, visit, visited)
 		for i := range root.Args {